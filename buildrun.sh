@@ -5,12 +5,18 @@ go env GOOS GOARCH GOROOT GOPATH
 
 # GOTRACKBACK=all
 
-   go build ./latlearn/latlearn.go \
+   go build ./latlearn             \
 && go build ./example-app1.go      \
 && go build ./example-app2.go      \
 && go build ./example-app3.go      \
 && go build ./example-app4.go      \
 && go build ./example-app5.go      \
+&& go build ./cmd/latlearn-diff     \
+&& go build ./cmd/latlearn-fold     \
+&& go build ./cmd/latlearn-gate     \
+&& go build ./cmd/latlearn-merge    \
+&& go build ./cmd/latlearn-replay   \
+&& go build ./cmd/latlearn-top      \
 && go test -v ./latlearn           \
 #&& ./example-app1                  \
 #&& ./example-app2                  \
@@ -0,0 +1,144 @@
+// latlearn/cmd/latlearn-diff/main.go
+//     project: https://github.com/mkramlich/LatLearn
+//
+// Compares two latency reports (text or JSON), like from before and after a
+// refactor, span by span. Usage:
+//
+//     latlearn-diff [flags] before-report after-report
+//
+// Example, worst mean regressions first, without latlearn's own spans:
+//
+//     latlearn-diff -sort regression -metric mean -builtins=false a.txt b.txt
+//
+// With -significance it instead reports, per span, whether the change is
+// more than noise, like benchstat. That wants JSON reports, whose histograms
+// allow a Mann-Whitney U test (or, failing that, their variances a Welch
+// t-test.) Text reports have neither, so get no verdict:
+//
+//     latlearn-diff -significance -confidence 0.99 base.json cand.json
+//
+// The text output starts with any context params (see latlearn.ReportWith)
+// which differ between the two, as a reminder of what else changed.
+
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "log"
+    "math"
+    "os"
+    "sort"
+    "strings"
+
+    "../../latlearn"
+)
+
+func main() {
+    sort_by  := flag.String( "sort",     "report", "row order: report (a's span order), regression, or name")
+    metric   := flag.String( "metric",   "mean",   "for -sort regression: min, mean, max, weight or time_frac")
+    builtins := flag.Bool(   "builtins", true,     "include latlearn's built-in \"LL.\" spans")
+    as_json  := flag.Bool(   "json",     false,    "write the diffs as JSON rather than a text table")
+    signif   := flag.Bool(   "significance", false, "test whether each span's change is significant, rather than diff every metric")
+    conf     := flag.Float64( "confidence",  0.95,  "for -significance: the confidence level")
+    test     := flag.String(  "test",        "auto", "for -significance: auto, mann-whitney or welch")
+    flag.Usage = func() {
+        fmt.Fprintf( flag.CommandLine.Output(), "usage: latlearn-diff [flags] before-report after-report\n")
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+
+    if (flag.NArg() != 2) {
+        flag.Usage()
+        os.Exit( 2)
+    }
+
+    a, err := latlearn.ReadReportFile( flag.Arg( 0))
+    if (err != nil) { log.Fatalf( "latlearn-diff: %s: %v\n", flag.Arg( 0), err)}
+    b, err := latlearn.ReadReportFile( flag.Arg( 1))
+    if (err != nil) { log.Fatalf( "latlearn-diff: %s: %v\n", flag.Arg( 1), err)}
+
+    if !*as_json { write_param_diffs( a, b)}
+
+    if *signif {
+        compare( a, b, *sort_by, *builtins, *as_json, latlearn.CompareOpts{ Confidence: *conf, Test: *test})
+        return
+    }
+
+    diffs  := []latlearn.SpanDiff {}
+    for _, d := range latlearn.Diff( a, b) {
+        if !*builtins && strings.HasPrefix( d.Name, "LL.") { continue}
+        diffs = append( diffs, d)
+    }
+
+    switch *sort_by {
+        case "report":
+        case "regression":
+            if err = latlearn.SortDiffsByRegression( diffs, *metric); (err != nil) {
+                log.Fatalf( "latlearn-diff: %v\n", err)
+            }
+        case "name":
+            sort.SliceStable( diffs, func( i, j int) bool { return diffs[i].Name < diffs[j].Name})
+        default:
+            log.Fatalf( "latlearn-diff: unknown -sort '%s'\n", *sort_by)
+    }
+
+    if *as_json {
+        enc := json.NewEncoder( os.Stdout)
+        enc.SetIndent( "", "  ")
+        err  = enc.Encode( diffs)
+    } else {
+        err  = latlearn.WriteDiff( os.Stdout, diffs)
+    }
+    if (err != nil) { log.Fatalf( "latlearn-diff: %v\n", err)}
+}
+
+// the context params which differ, like "N: 100 -> 1000", then a blank line. nothing if none
+func write_param_diffs( a *latlearn.ReportData, b *latlearn.ReportData) {
+    diffs    := latlearn.DiffParams( a.Meta, b.Meta)
+    if (len( diffs) == 0) { return}
+
+    fmt.Println( "params which differ:")
+    for _, d := range diffs {
+        av, bv := d.A, d.B
+        if !d.In_a { av = "(none)"}
+        if !d.In_b { bv = "(none)"}
+        fmt.Printf( "  %s: %s -> %s\n", d.Key, av, bv)
+    }
+    fmt.Println()
+}
+
+func compare( a *latlearn.ReportData, b *latlearn.ReportData, sort_by string, builtins bool, as_json bool, opts latlearn.CompareOpts) {
+    all, err := latlearn.Compare( a, b, opts)
+    if (err != nil) { log.Fatalf( "latlearn-diff: %v\n", err)}
+
+    cmps     := []latlearn.SpanCompare {}
+    for _, c := range all {
+        if !builtins && strings.HasPrefix( c.Name, "LL.") { continue}
+        cmps  = append( cmps, c)
+    }
+
+    switch sort_by {
+        case "report":
+        case "regression": // significant slowdowns first, the worst at top
+            key := func( i int) float64 {
+                if !cmps[ i].Significant || !cmps[ i].Delta.Pct_valid { return math.Inf( -1)}
+                return cmps[ i].Delta.Pct
+            }
+            sort.SliceStable( cmps, func( i, j int) bool { return key( i) > key( j)})
+        case "name":
+            sort.SliceStable( cmps, func( i, j int) bool { return cmps[i].Name < cmps[j].Name})
+        default:
+            log.Fatalf( "latlearn-diff: unknown -sort '%s'\n", sort_by)
+    }
+
+    if as_json {
+        enc := json.NewEncoder( os.Stdout)
+        enc.SetIndent( "", "  ")
+        err  = enc.Encode( cmps)
+    } else {
+        err  = latlearn.WriteCompare( os.Stdout, cmps)
+    }
+    if (err != nil) { log.Fatalf( "latlearn-diff: %v\n", err)}
+}
@@ -0,0 +1,56 @@
+// latlearn/cmd/latlearn-fold/main.go
+//     project: https://github.com/mkramlich/LatLearn
+//
+// Writes a latency report's spans (text or JSON) to stdout as folded stacks,
+// weighted by their Cumul in ns, for flamegraph tooling. Like:
+//
+//     latlearn-fold latlearn-report.json | flamegraph.pl > spans.svg
+//
+// The stacks come from the '/' segments of span names, with each variant
+// under its parent. See latlearn.WriteFoldedStacks. The "LL." spans are left
+// out unless -builtins.
+
+package main
+
+import (
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "strings"
+
+    "../../latlearn"
+)
+
+func main() {
+    builtins   := flag.Bool( "builtins", false, "also include the \"LL.\" spans")
+    flag.Usage  = func() {
+        fmt.Fprintf( flag.CommandLine.Output(), "usage: latlearn-fold [-builtins] report\n")
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+
+    if (flag.NArg() != 1) {
+        flag.Usage()
+        os.Exit( 2)
+    }
+
+    rd, err    := latlearn.ReadReportFile( flag.Arg( 0))
+    if (err != nil) {
+        log.Printf( "latlearn-fold: %s: %v\n", flag.Arg( 0), err)
+        os.Exit( 2)
+    }
+
+    if !*builtins {
+        spans  := rd.Spans[ :0]
+        for _, sd := range rd.Spans {
+            if !strings.HasPrefix( sd.Name, "LL.") { spans = append( spans, sd)}
+        }
+        rd.Spans = spans
+    }
+
+    if err = latlearn.WriteFoldedStacks( os.Stdout, rd); (err != nil) {
+        log.Printf( "latlearn-fold: %v\n", err)
+        os.Exit( 1)
+    }
+}
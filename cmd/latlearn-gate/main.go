@@ -0,0 +1,75 @@
+// latlearn/cmd/latlearn-gate/main.go
+//     project: https://github.com/mkramlich/LatLearn
+//
+// A regression gate for CI. Checks a latency report (text or JSON) against a
+// file of per-span latency budgets, and exits non-zero if any were broken,
+// after printing a table of the violations. Usage:
+//
+//     latlearn-gate -budgets budgets.txt [-strict] report
+//
+// Exit status is 0 if all budgets were met, 1 if any were broken, and 2 on
+// any usage or input error. See latlearn.Budget for the budget file format.
+// Percentile budgets (like p99) need a JSON report, since only it carries the
+// histograms they are computed from.
+
+package main
+
+import (
+    "flag"
+    "fmt"
+    "log"
+    "os"
+
+    "../../latlearn"
+)
+
+func main() {
+    budgets_fpath := flag.String( "budgets", "", "path of the budget file (required)")
+    strict        := flag.Bool(   "strict",  false, "also fail if a budget matched no completed span")
+    flag.Usage     = func() {
+        fmt.Fprintf( flag.CommandLine.Output(), "usage: latlearn-gate -budgets budgets.txt [-strict] report\n")
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+
+    if (flag.NArg() != 1) || (*budgets_fpath == "") {
+        flag.Usage()
+        os.Exit( 2)
+    }
+
+    f, err := os.Open( *budgets_fpath)
+    if (err != nil) {
+        log.Printf( "latlearn-gate: %v\n", err)
+        os.Exit( 2)
+    }
+    budgets, err := latlearn.ParseBudgets( f)
+    f.Close()
+    if (err != nil) {
+        log.Printf( "latlearn-gate: %s: %v\n", *budgets_fpath, err)
+        os.Exit( 2)
+    }
+
+    rd, err := latlearn.ReadReportFile( flag.Arg( 0))
+    if (err != nil) {
+        log.Printf( "latlearn-gate: %s: %v\n", flag.Arg( 0), err)
+        os.Exit( 2)
+    }
+
+    violations, unmatched := latlearn.CheckBudgets( rd, budgets)
+
+    for _, b := range unmatched {
+        fmt.Fprintf( os.Stderr, "latlearn-gate: warning: budget on line %d (%s %s) matched no completed span\n", b.Line, b.Pattern, b.Metric)
+    }
+
+    if (len( violations) > 0) {
+        fmt.Printf( "%d latency budget violation(s) in %s:\n\n", len( violations), flag.Arg( 0))
+        latlearn.WriteViolations( os.Stdout, violations)
+        os.Exit( 1)
+    }
+    if *strict && (len( unmatched) > 0) {
+        fmt.Printf( "%d latency budget(s) matched no completed span, in %s\n", len( unmatched), flag.Arg( 0))
+        os.Exit( 1)
+    }
+
+    fmt.Printf( "all %d latency budgets met, in %s\n", len( budgets), flag.Arg( 0))
+}
@@ -0,0 +1,107 @@
+// latlearn/cmd/latlearn-merge/main.go
+//     project: https://github.com/mkramlich/LatLearn
+//
+// Merges the stats of several processes or runs, like test shards or service
+// replicas, into one fleet-wide picture. Each input may be a state (from
+// latlearn.SaveState) or a report (text or JSON.) Usage:
+//
+//     latlearn-merge [flags] input1 input2 ...
+//
+// By default it writes the merged state, which records which inputs sampled
+// each span. With -report it instead writes a JSON report, which
+// latlearn-diff and latlearn-gate can read:
+//
+//     latlearn-merge -report -o fleet.json shard-*.json
+//
+// With -where it merges only the inputs with those context params (see
+// latlearn.ReportWith), like to merge only the runs with N=1000 on 8 cores:
+//
+//     latlearn-merge -where N=1000,cores=8 -report run-*.json
+
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "strings"
+
+    "../../latlearn"
+)
+
+// a state, as is, or else a report, made into one
+func read_input( fpath string) (st *latlearn.State, err error) {
+    data, err := os.ReadFile( fpath)
+    if (err != nil) { return nil, err}
+
+    var head struct { Format string `json:"format"` }
+    if (json.Unmarshal( data, &head) == nil) && (head.Format == latlearn.STATE_FORMAT) {
+        st, err = latlearn.ReadState( bytes.NewReader( data))
+        if (err == nil) && (st.Label == "") { st.Label = fpath}
+        return st, err
+    }
+
+    rd, err := latlearn.ReadReport( bytes.NewReader( data))
+    if (err != nil) { return nil, err}
+    return latlearn.StateOfReport( rd, fpath), nil
+}
+
+// whether st has every one of params, with the same value
+func has_params( st *latlearn.State, params []latlearn.Param) bool {
+    for _, p := range params {
+        if v, found := latlearn.ParamValue( st.Meta, p.Key); !found || (v != p.Value) { return false}
+    }
+    return true
+}
+
+func main() {
+    out_fpath := flag.String( "o",      "",    "write to this file rather than stdout")
+    as_report := flag.Bool(   "report", false, "write a JSON report rather than a state")
+    where     := flag.String( "where",  "",    "comma-separated key=value params. merge only the inputs which have them all")
+    flag.Usage = func() {
+        fmt.Fprintf( flag.CommandLine.Output(), "usage: latlearn-merge [flags] input1 input2 ...\n")
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+
+    if (flag.NArg() < 1) {
+        flag.Usage()
+        os.Exit( 2)
+    }
+
+    wanted := []latlearn.Param {}
+    if (*where != "") {
+        for _, kv := range strings.Split( *where, ",") {
+            k, v, found := strings.Cut( kv, "=")
+            if !found { log.Fatalf( "latlearn-merge: -where wants key=value, got '%s'\n", kv)}
+            wanted = append( wanted, latlearn.Param{ Key: strings.TrimSpace( k), Value: strings.TrimSpace( v)})
+        }
+    }
+
+    inputs := []*latlearn.State {}
+    for _, fpath := range flag.Args() {
+        st, err := read_input( fpath)
+        if (err != nil) { log.Fatalf( "latlearn-merge: %s: %v\n", fpath, err)}
+        if !has_params( st, wanted) { continue}
+        inputs   = append( inputs, st)
+    }
+    if (len( inputs) == 0) { log.Fatalf( "latlearn-merge: no input has the -where params\n")}
+    merged := latlearn.Merge( inputs...)
+
+    var out any = merged
+    if *as_report { out = latlearn.ReportOfState( merged)}
+
+    data, err := json.MarshalIndent( out, "", "  ")
+    if (err != nil) { log.Fatalf( "latlearn-merge: %v\n", err)}
+    data       = append( data, '\n')
+
+    if (*out_fpath == "") {
+        _, err = os.Stdout.Write( data)
+    } else {
+        err    = os.WriteFile( *out_fpath, data, 0644)
+    }
+    if (err != nil) { log.Fatalf( "latlearn-merge: %v\n", err)}
+}
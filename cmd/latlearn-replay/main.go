@@ -0,0 +1,98 @@
+// latlearn/cmd/latlearn-replay/main.go
+//     project: https://github.com/mkramlich/LatLearn
+//
+// Rebuilds a latency report from a sample log (see latlearn.Sample_log_fpath)
+// without rerunning the app. Like for only the 30 seconds after a lag spike,
+// and only the physics spans:
+//
+//     latlearn-replay -from 12m -to 12m30s -spans 'physics*,collide(*)' samples.bin
+//
+// Writes a text report by default, or JSON with -json, or HTML with -html.
+// The text and JSON ones can be read by latlearn-diff and latlearn-gate.
+// Which rows, and their order, can be chosen the same as for a live report
+// (see latlearn.ReportOpts), like -sort tf -top 20 -collapse.
+
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "strings"
+
+    "../../latlearn"
+)
+
+func main() {
+    from      := flag.Duration( "from",     0,     "only samples which started at or after this, since the app's Init")
+    to        := flag.Duration( "to",       0,     "... and before this. 0 means to the end of the log")
+    spans     := flag.String(   "spans",    "",    "comma-separated span patterns (globs, or re:regexps.) empty means all")
+    as_json   := flag.Bool(     "json",     false, "write a JSON report rather than a text one")
+    as_html   := flag.Bool(     "html",     false, "write a self-contained HTML report rather than a text one")
+    out_fpath := flag.String(   "o",        "",    "write to this file rather than stdout")
+    sort_key  := flag.String(   "sort",     "",    "sort the rows by: " + strings.Join( latlearn.Report_sort_keys, ", ") + ". empty keeps the order first sampled")
+    top_n     := flag.Int(      "top",      0,     "show only the N spans with the greatest time frac. 0 means all")
+    exclude   := flag.String(   "exclude",  "",    "comma-separated span patterns whose rows are not shown")
+    only      := flag.String(   "only",     "",    "show only the parents, or only the variants")
+    collapse  := flag.Bool(     "collapse", false, "hide the variants of each parent shown")
+    group     := flag.Bool(     "group",    false, "show each variant right after its parent")
+    flag.Usage = func() {
+        fmt.Fprintf( flag.CommandLine.Output(), "usage: latlearn-replay [flags] sample-log\n")
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+
+    if (flag.NArg() != 1) {
+        flag.Usage()
+        os.Exit( 2)
+    }
+
+    opts      := latlearn.ReplayOpts{ From: *from, To: *to}
+    if (*spans != "") {
+        for _, pattern := range strings.Split( *spans, ",") {
+            opts.Spans = append( opts.Spans, strings.TrimSpace( pattern))
+        }
+    }
+
+    f, err    := os.Open( flag.Arg( 0))
+    if (err != nil) { log.Fatalf( "latlearn-replay: %v\n", err)}
+    defer f.Close()
+
+    slr, err  := latlearn.ReadSampleLog( f)
+    if (err != nil) { log.Fatalf( "latlearn-replay: %s: %v\n", flag.Arg( 0), err)}
+    rd, err   := latlearn.Replay( slr, opts)
+    if (err != nil) { log.Fatalf( "latlearn-replay: %s: %v\n", flag.Arg( 0), err)}
+
+    ropts     := latlearn.ReportOpts{ Sort: *sort_key, Top_n: *top_n, Only: *only, Collapse: *collapse, Group: *group}
+    if (*exclude != "") {
+        for _, pattern := range strings.Split( *exclude, ",") {
+            ropts.Exclude = append( ropts.Exclude, strings.TrimSpace( pattern))
+        }
+    }
+    rd, err    = latlearn.ApplyReportOpts( rd, ropts)
+    if (err != nil) { log.Fatalf( "latlearn-replay: %v\n", err)}
+
+    out       := os.Stdout
+    if (*out_fpath != "") {
+        out, err = os.Create( *out_fpath)
+        if (err != nil) { log.Fatalf( "latlearn-replay: %v\n", err)}
+    }
+    w         := bufio.NewWriter( out)
+
+    switch {
+        case *as_json:
+            enc := json.NewEncoder( w)
+            enc.SetIndent( "", "  ")
+            err  = enc.Encode( rd)
+        case *as_html:
+            err  = latlearn.WriteReportHTML( w, rd)
+        default:
+            err  = latlearn.WriteReport( w, rd)
+    }
+    if (err == nil) { err = w.Flush()}
+    if (err == nil) { err = out.Close()}
+    if (err != nil) { log.Fatalf( "latlearn-replay: %v\n", err)}
+}
@@ -0,0 +1,79 @@
+// latlearn/cmd/latlearn-top/main.go
+//     project: https://github.com/mkramlich/LatLearn
+//
+// A live, top-style view of another process's spans. The source is either a
+// local endpoint the app serves with latlearn.SnapshotHandler, or a report
+// file it rewrites (like a JSON one, with Report_json_fpath set, and Report
+// called every so often.) Like:
+//
+//     latlearn-top -sort rate -rows 20 http://localhost:6061/
+//     latlearn-top latlearn-report.json
+//
+// Quit with Ctrl-C.
+
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "log"
+    "net/http"
+    "os"
+    "os/signal"
+    "strings"
+    "time"
+
+    "../../latlearn"
+)
+
+// one snapshot, from the endpoint at src, or else the report file at src
+func fetch( src string) (rd *latlearn.ReportData, err error) {
+    if !strings.HasPrefix( src, "http://") && !strings.HasPrefix( src, "https://") {
+        return latlearn.ReadReportFile( src)
+    }
+
+    resp, err := http.Get( src)
+    if (err != nil) { return nil, err}
+    defer resp.Body.Close()
+
+    if (resp.StatusCode != http.StatusOK) {
+        return nil, fmt.Errorf( "%s: %s", src, resp.Status)
+    }
+    return latlearn.ReadReport( resp.Body)
+}
+
+func main() {
+    interval  := flag.Duration( "interval",  time.Second, "between redraws")
+    sort_key  := flag.String(   "sort",      "mean",      "sort by: " + strings.Join( latlearn.Top_sort_keys, ", "))
+    rows      := flag.Int(      "rows",      0,           "at most this many span rows. 0 means all")
+    deviation := flag.Float64(  "deviation", 1.5,         "flag a span whose recent mean is this many times off its baseline")
+    builtins  := flag.Bool(     "builtins",  false,       "also show the LL. spans")
+    no_color  := flag.Bool(     "no-color",  false,       "no ANSI colors")
+    flag.Usage = func() {
+        fmt.Fprintf( flag.CommandLine.Output(), "usage: latlearn-top [flags] url-or-report-file\n")
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+
+    if (flag.NArg() != 1) {
+        flag.Usage()
+        os.Exit( 2)
+    }
+    src       := flag.Arg( 0)
+
+    ctx, stop := signal.NotifyContext( context.Background(), os.Interrupt)
+    defer stop()
+
+    opts      := latlearn.TopOpts{
+                     Interval:  *interval,
+                     Sort:      *sort_key,
+                     Rows:      *rows,
+                     Deviation: *deviation,
+                     Builtins:  *builtins,
+                     No_color:  *no_color}
+    err       := latlearn.TopFrom( ctx, os.Stdout, opts, func() (*latlearn.ReportData, error) { return fetch( src)})
+    if (err   != nil) {
+        log.Fatalf( "latlearn-top: %v", err)
+    }
+}
@@ -1,4 +1,7 @@
 #!/bin/sh
 
-cp ~/projects/mine/Slartboz/priv/latlearn/latlearn.go ./latlearn/
+for f in ~/projects/mine/Slartboz/priv/latlearn/*.go; do
+    case $f in *_test.go) continue;; esac
+    cp $f ./latlearn/
+done
 
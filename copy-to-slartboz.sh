@@ -1,4 +1,7 @@
 #!/bin/sh
 
-cp ./latlearn/latlearn.go ~/projects/mine/Slartboz/priv/latlearn/
+for f in ./latlearn/*.go; do
+    case $f in *_test.go) continue;; esac
+    cp $f ~/projects/mine/Slartboz/priv/latlearn/
+done
 
@@ -1,3 +1,3 @@
 #!/bin/sh
 
-vi ./README.md ../Slartboz/priv/notes/TODO-latlearn.txt ./latlearn/latlearn.go ./example-app1.go ./example-app2.go ./example-app3.go ./example-app4.go ./example-app5.go ./buildrun.sh
+vi ./README.md ../Slartboz/priv/notes/TODO-latlearn.txt ./latlearn/*.go ./example-app1.go ./example-app2.go ./example-app3.go ./example-app4.go ./example-app5.go ./buildrun.sh
@@ -67,17 +67,23 @@ func main() {
     // let's print a basic report:
     latlearn.Report()
 
-    // We might want to include some context params in our report. If so, give the report generating function a list of strings. A context parameter might be some fact or metadata that the audience would feel is relevant, especially to make a correct interpretation of the metrics, and a correct deduction about their own next course of action.
+    // We might want to include some context params in our report. If so, give the report generating function a list of key/value params. A context parameter might be some fact or metadata that the audience would feel is relevant, especially to make a correct interpretation of the metrics, and a correct deduction about their own next course of action.
 
-    params := []string { "ver=1.2", "commit=whatever", "N=2", "cores=2"}
-    latlearn.Report2( params)
+    params := []latlearn.Param { { Key: "N", Value: "2"}, { Key: "cores", Value: "2"}} // no need for a version or commit: the report has the build info
+    latlearn.ReportWith( params)
 
     // It just wrote a report (on latency stats) into a file at "./latlearn-report.txt"
 
     // If you look at the report you'll see a lot of ??? for some LL benchmark spans
     // because they were not performed. They are purely optional.
 
-    // If you wish to perform them call Benchmarks:
+    // You can also add reference tasks of your own, which your team already has a
+    // feel for. They run (and get reported) after the built-in ones, under spans
+    // prefixed by latlearn.User_benchmark_prefix ("user." by default):
+    latlearn.RegisterBenchmark( "sprintf-int", 1000, nil, func() { _ = fmt.Sprintf( "%d", 12345)})
+
+    // If you wish to perform them call Benchmarks. (Or BenchmarksCtx, to be able to
+    // cancel them, give them a time budget, tweak iteration counts, or get progress.)
     log.Printf( "about to call latlearn.Benchmarks. can take over 1 min on slower Mac\n")
     latlearn.Benchmarks()
 
@@ -86,7 +92,7 @@ func main() {
     // To change the report's file path, do like:
     latlearn.Report_fpath = "latlearn-report2.txt"
     // There were no changes to any context param. we just want to see the benchmark metrics which should now appear in the report:
-    latlearn.Report2( params)
+    latlearn.ReportWith( params)
 
     // NOTE: All of LL's built-in spans (like for benchmarks) have names starting with "LL."
     // By the way, latlearn also measures the latency of its own report generation. It names that span "LL.lat-report"
@@ -99,7 +105,7 @@ func main() {
     // The below may start to feel a little verbose (boilerplatey) but we express it like this to reinforce that you can continually adjust the report params and file path as you go. which is helpful for testing, and for doing comparisons while doing troubleshooting or tuning work
 
     latlearn.Report_fpath = "latlearn-report3.txt"
-    latlearn.Report2( params)
+    latlearn.ReportWith( params)
 
     // In this report you'll see metrics for fn2 reported for the first time.
     // Note that fn2's AVG latency is (almost certainly) smaller (faster) than fn1. That is because its code body is similar, except it lacks any Printf call. Typically, turning off any output writes (esp to log files) yields a significant reduction in latency (on a typical machine, ayway.) Though in this case fn2 contributes to much more of the program's overall total run latency, measured from process start to end. Because, unlike fn1, it was called 100,234 times.
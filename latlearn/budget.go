@@ -0,0 +1,238 @@
+// budget.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// A latency budget, for one metric of every span whose name matches Pattern.
+// Budgets are written one per line, like:
+//
+//     # span-pattern   metric  op  limit
+//     fn2              mean    <=  400ns
+//     is-mv-bl(*)      p99     <=  2ms
+//     LL.*             max     <   5ms
+//     re:^task-\d+/    mean    <=  1.5ms
+//     fn3              weight  >=  100
+//     loop             tf      <=  0.9
+//
+// A pattern is a glob, where '*' matches any run of chars (including '/')
+// and '?' any one char, matched against the whole span name. Or, if it
+// starts with "re:", a regular expression. The metric is one of min, last,
+// max, mean, weight, tf (time fraction) or a percentile like p50, p99 or
+// p99.9. Latency limits take a unit (ns, us, ms, s) and a bare number means
+// ns. The op is one of <=, <, >=, >, ==.
+type Budget struct {
+    Pattern string  `json:"pattern"`
+    Metric  string  `json:"metric"`
+    Op      string  `json:"op"`
+    Limit   float64 `json:"limit"` // in ns, for latency metrics
+    Line    int     `json:"line"`  // in the budget file, for messages
+    re      *regexp.Regexp
+}
+
+// A span which broke a budget. Or, if Err is set, could not be checked
+// against it (like for a percentile, when the report had no histograms.)
+type Violation struct {
+    Budget Budget  `json:"budget"`
+    Span   string  `json:"span"`
+    Value  float64 `json:"value"`
+    Err    string  `json:"err,omitempty"`
+}
+
+// for latlearn's internal use only
+func glob_regexp( pattern string) (re *regexp.Regexp, err error) {
+    if   expr, found := strings.CutPrefix( pattern, "re:"); found {
+        return regexp.Compile( expr)
+    }
+
+    expr := ""
+    for _, c := range pattern {
+        switch c {
+            case '*': expr += ".*"
+            case '?': expr += "."
+            default:  expr += regexp.QuoteMeta( string( c))
+        }
+    }
+    return regexp.Compile( "^" + expr + "$")
+}
+
+// for latlearn's internal use only
+func budget_metric_ok( metric string) bool {
+    switch metric {
+        case "min", "last", "max", "mean", "weight", "tf": return true
+    }
+    q, err := quantile_of_metric( metric)
+    return (err == nil) && (q >= 0) && (q <= 1)
+}
+
+// for latlearn's internal use only
+//
+// Like "p99" to 0.99, or "p99.9" to 0.999.
+func quantile_of_metric( metric string) (q float64, err error) {
+    txt, found := strings.CutPrefix( metric, "p")
+    if !found { return -1, fmt.Errorf( "not a percentile: %s", metric)}
+    pct, err   := strconv.ParseFloat( txt, 64)
+    if (err != nil) { return -1, err}
+    return pct / 100, nil
+}
+
+// for latlearn's internal use only
+func parse_budget_limit( metric string, txt string) (limit float64, err error) {
+    if (metric == "weight") || (metric == "tf") {
+        return strconv.ParseFloat( txt, 64)
+    }
+    if v, err := strconv.ParseFloat( txt, 64); (err == nil) {
+        return v, nil // bare number means ns
+    }
+    dur, err   := time.ParseDuration( txt)
+    if (err != nil) { return 0, err}
+    return float64( dur.Nanoseconds()), nil
+}
+
+// Reads budgets, one per line, in the format described for Budget. Blank
+// lines, and anything after a '#', are ignored.
+func ParseBudgets( r io.Reader) (budgets []Budget, err error) {
+    pre       := "latlearn.ParseBudgets"
+    scanner   := bufio.NewScanner( r)
+    line_num  := 0
+
+    for scanner.Scan() {
+        line_num++
+        line  := scanner.Text()
+        if i  := strings.Index( line, "#"); (i != -1) { line = line[:i]}
+        fields := strings.Fields( line)
+        if (len( fields) == 0) { continue}
+
+        // allow the op and limit to be written without a space, like "<=400ns"
+        if (len( fields) == 3) {
+            for _, op := range []string { "<=", ">=", "==", "<", ">"} {
+                if limit, found := strings.CutPrefix( fields[2], op); found {
+                    fields = []string { fields[0], fields[1], op, limit}
+                    break
+                }
+            }
+        }
+        if (len( fields) != 4) {
+            return nil, fmt.Errorf( "%s: line %d: want 'pattern metric op limit', got '%s'", pre, line_num, strings.TrimSpace( line))
+        }
+
+        b     := Budget{ Pattern: fields[0], Metric: fields[1], Op: fields[2], Line: line_num}
+        if !budget_metric_ok( b.Metric) {
+            return nil, fmt.Errorf( "%s: line %d: unknown metric '%s'", pre, line_num, b.Metric)
+        }
+        switch b.Op {
+            case "<=", "<", ">=", ">", "==":
+            default: return nil, fmt.Errorf( "%s: line %d: unknown op '%s'", pre, line_num, b.Op)
+        }
+        if b.Limit, err = parse_budget_limit( b.Metric, fields[3]); (err != nil) {
+            return nil, fmt.Errorf( "%s: line %d: bad limit '%s': %v", pre, line_num, fields[3], err)
+        }
+        if b.re, err    = glob_regexp( b.Pattern); (err != nil) {
+            return nil, fmt.Errorf( "%s: line %d: bad pattern '%s': %v", pre, line_num, b.Pattern, err)
+        }
+        budgets = append( budgets, b)
+    }
+    if err = scanner.Err(); (err != nil) {
+        return nil, fmt.Errorf( "%s: %v", pre, err)
+    }
+    return budgets, nil
+}
+
+// for latlearn's internal use only
+func span_metric( sd SpanData, metric string) (value float64, err error) {
+    switch metric {
+        case "min":    return float64( sd.Min),    nil
+        case "last":   return float64( sd.Last),   nil
+        case "max":    return float64( sd.Max),    nil
+        case "mean":   return float64( sd.Mean),   nil
+        case "weight": return float64( sd.Weight), nil
+        case "tf":     return sd.Time_frac,        nil
+    }
+    q, err := quantile_of_metric( metric)
+    if (err != nil) { return 0, err}
+    ns, ok := sd.Quantile( q)
+    if !ok {
+        return 0, fmt.Errorf( "no histogram for %s. (text reports have none: use a JSON report)", metric)
+    }
+    return float64( ns), nil
+}
+
+// Checks every completed span of the report against every budget whose
+// pattern matches it. Spans which never completed are skipped. Also returns
+// the budgets which matched no completed span at all, since in CI that may
+// mean a span was renamed, or its instrumentation lost.
+func CheckBudgets( rd *ReportData, budgets []Budget) (violations []Violation, unmatched []Budget) {
+    for _, b       := range budgets {
+        re         := b.re
+        if (re     == nil) { re, _ = glob_regexp( b.Pattern)}
+
+        matched    := false
+        for _, sd  := range rd.Spans {
+            if !sd.Completed || (re == nil) || !re.MatchString( sd.Name) { continue}
+            matched = true
+
+            value, err := span_metric( sd, b.Metric)
+            if (err != nil) {
+                violations = append( violations, Violation{ Budget: b, Span: sd.Name, Err: err.Error()})
+                continue
+            }
+
+            ok     := false
+            switch b.Op {
+                case "<=": ok = (value <= b.Limit)
+                case "<":  ok = (value <  b.Limit)
+                case ">=": ok = (value >= b.Limit)
+                case ">":  ok = (value >  b.Limit)
+                case "==": ok = (value == b.Limit)
+            }
+            if !ok {
+                violations = append( violations, Violation{ Budget: b, Span: sd.Name, Value: value})
+            }
+        }
+        if !matched { unmatched = append( unmatched, b)}
+    }
+    return violations, unmatched
+}
+
+// for latlearn's internal use only
+func budget_value_txt( metric string, value float64) string {
+    if (metric == "tf") { return fmt.Sprintf( "%f", value)}
+    if (metric == "weight") { return number_grouped( int64( value), ",")}
+    return number_grouped( int64( value), ",") + " ns"
+}
+
+// Writes violations as a plain text table, one row per span and budget.
+func WriteViolations( w io.Writer, violations []Violation) (err error) {
+    longest_name := len( "span")
+    for _, v     := range violations {
+        if (len( v.Span) > longest_name) { longest_name = len( v.Span)}
+    }
+
+    name_field   := fmt.Sprintf( "%%-%ds", longest_name)
+    format       := name_field + " | %-6s | %21s | %-2s %21s | %s\n"
+
+    _, err        = fmt.Fprintf( w, format, "span", "metric", "actual", "", "budget", "budget line")
+    if (err != nil) { return err}
+
+    for _, v     := range violations {
+        actual   := budget_value_txt( v.Budget.Metric, v.Value)
+        if (v.Err != "") { actual = "?"}
+        detail   := fmt.Sprintf( "%d: %s", v.Budget.Line, v.Budget.Pattern)
+        if (v.Err != "") { detail += ": " + v.Err}
+
+        _, err    = fmt.Fprintf( w, format,
+                        v.Span, v.Budget.Metric, actual,
+                        v.Budget.Op, budget_value_txt( v.Budget.Metric, v.Budget.Limit), detail)
+        if (err != nil) { return err}
+    }
+    return nil
+}
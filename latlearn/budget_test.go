@@ -0,0 +1,65 @@
+package latlearn_test
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+
+    "."
+)
+
+func TestBudgets( t *testing.T) {
+    txt := `
+        # span-pattern  metric  op  limit
+        fn2             mean    <=  400ns
+        fn4(*)          max     <   50us   # variants only
+        re:^task-\d+/   p99     <=  2ms
+        LL.*            weight  >=  1
+        nosuch          mean    <=  1s
+    `
+    budgets, err := latlearn.ParseBudgets( strings.NewReader( txt))
+    if (err != nil) || (len( budgets) != 5) {
+        t.Fatalf( "ParseBudgets: want 5 budgets, got %d, err %v", len( budgets), err)
+    }
+    if (budgets[1].Limit != 50_000) || (budgets[1].Op != "<") || (budgets[1].Line != 4) {
+        t.Errorf( "ParseBudgets fn4(*): got %#v", budgets[1])
+    }
+
+    for _, bad := range []string { "fn2 mean <= 400ns extra", "fn2 avg <= 1ms", "fn2 mean => 1ms", "fn2 mean <= fast"} {
+        if _, err := latlearn.ParseBudgets( strings.NewReader( bad)); (err == nil) {
+            t.Errorf( "ParseBudgets '%s': want an error", bad)
+        }
+    }
+
+    // 99 fast samples and 1 slow one, so p99 is fast and p100 is slow
+    hist := []latlearn.HistBucket { { Lo: 1000, Hi: 1001, Count: 99}, { Lo: 5_000_000, Hi: 5_100_000, Count: 1}}
+    rd   := &latlearn.ReportData{ Spans: []latlearn.SpanData {
+                span_row( "fn2",            500, 10),
+                span_row( "fn4",          40000, 10),
+                span_row( "fn4(a=1,b=1)", 40000, 10), // max is 2 * mean
+                { Name: "task-537/worker-3", Completed: true, Min: 1000, Max: 5_050_000, Mean: 51_000, Weight: 100, Hist: hist},
+                { Name: "task-538/worker-1", Completed: true, Min: 1000, Max: 5_050_000, Mean: 51_000, Weight: 100}, // no hist
+                { Name: "LL.no-op", Min: -1, Last: -1, Max: -1, Mean: -1, Cumul: -1, Weight: -1}}}
+
+    violations, unmatched := latlearn.CheckBudgets( rd, budgets)
+
+    got  := []string {}
+    for _, v := range violations {
+        got   = append( got, v.Span + " " + v.Budget.Metric)
+        if (v.Span == "task-538/worker-1") && (v.Err == "") {
+            t.Errorf( "CheckBudgets: want an Err for p99 without a histogram")
+        }
+    }
+    want := []string { "fn2 mean", "fn4(a=1,b=1) max", "task-538/worker-1 p99"}
+    if (strings.Join( got, ", ") != strings.Join( want, ", ")) {
+        t.Errorf( "CheckBudgets violations: want %v, got %v", want, got)
+    }
+    if (len( unmatched) != 2) || (unmatched[0].Pattern != "LL.*") || (unmatched[1].Pattern != "nosuch") {
+        t.Errorf( "CheckBudgets unmatched: got %#v", unmatched)
+    }
+
+    var buf bytes.Buffer
+    if err := latlearn.WriteViolations( &buf, violations); (err != nil) || !strings.Contains( buf.String(), "fn4(a=1,b=1)") {
+        t.Errorf( "WriteViolations: got err %v, text:\n%s", err, buf.String())
+    }
+}
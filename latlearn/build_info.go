@@ -0,0 +1,148 @@
+// build_info.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "fmt"
+    "io"
+    "runtime/debug"
+    "strings"
+    "sync"
+)
+
+// What the Go toolchain embedded in the binary about its own build (see
+// debug.ReadBuildInfo), so every report is tied to the exact build it
+// measured. The VCS facts are only there if the main module was built from a
+// checkout, with -buildvcs on (the default.) Zero values mean "unknown".
+type BuildInfo struct {
+    Main_path    string      `json:"main_path"`    // like "github.com/you/app". "command-line-arguments" for a go run of files
+    Main_version string      `json:"main_version"` // like "v1.2.3", or "(devel)"
+    Vcs          string      `json:"vcs"`          // like "git"
+    Vcs_revision string      `json:"vcs_revision"` // like a commit hash
+    Vcs_time     string      `json:"vcs_time"`     // of the commit. RFC3339
+    Vcs_modified string      `json:"vcs_modified"` // "true" if the tree had uncommitted changes. "" if unknown
+    Build_flags  []string    `json:"build_flags,omitempty"` // like "-tags=netgo", "-ldflags=-s" or "CGO_ENABLED=0"
+    Arch_level   string      `json:"arch_level"`   // like "GOAMD64=v3"
+    Deps         []BuildDep  `json:"deps,omitempty"`
+}
+
+// One module the binary was built with.
+type BuildDep struct {
+    Path    string `json:"path"`
+    Version string `json:"version"`
+    Replace string `json:"replace,omitempty"` // like "../fork" or "example.com/fork v1.0.1", if replaced
+}
+
+// for latlearn's internal use only
+var (
+    build_info_once   sync.Once
+    build_info_cached BuildInfo
+)
+
+// for latlearn's internal use only
+//
+// The settings which give the minimum level of the target arch's instruction
+// set. Only the one for GOARCH is set in a build.
+var arch_level_keys = []string { "GOAMD64", "GOARM", "GOARM64", "GO386", "GOMIPS", "GOMIPS64", "GOPPC64", "GORISCV64", "GOWASM"}
+
+// for latlearn's internal use only
+//
+// This binary's BuildInfo. It does not change, so it is read only once.
+func build_info() BuildInfo {
+    build_info_once.Do( func() {
+        bi, ok := debug.ReadBuildInfo()
+        if !ok { return}
+        build_info_cached = build_info_of( bi)
+    })
+    return build_info_cached
+}
+
+// for latlearn's internal use only
+func build_info_of( bi *debug.BuildInfo) (b BuildInfo) {
+    b.Main_path    = bi.Main.Path
+    b.Main_version = bi.Main.Version
+
+    for _, s := range bi.Settings {
+        switch {
+            case (s.Key == "vcs"):          b.Vcs          = s.Value
+            case (s.Key == "vcs.revision"): b.Vcs_revision = s.Value
+            case (s.Key == "vcs.time"):     b.Vcs_time     = s.Value
+            case (s.Key == "vcs.modified"): b.Vcs_modified = s.Value
+            case strings.HasPrefix( s.Key, "-") || (s.Key == "CGO_ENABLED"):
+                b.Build_flags = append( b.Build_flags, s.Key + "=" + s.Value)
+            default:
+                for _, key := range arch_level_keys {
+                    if (s.Key == key) { b.Arch_level = s.Key + "=" + s.Value}
+                }
+        }
+    }
+
+    for _, dep := range bi.Deps {
+        bd     := BuildDep{ Path: dep.Path, Version: dep.Version}
+        if (dep.Replace != nil) {
+            bd.Replace = strings.TrimSpace( dep.Replace.Path + " " + dep.Replace.Version)
+        }
+        b.Deps  = append( b.Deps, bd)
+    }
+    return b
+}
+
+// for latlearn's internal use only
+//
+// The text report's "build." lines. A build flag is one "build.flag" line
+// each, as one may have spaces in it, like "-ldflags=-s -w". A dep is one
+// "build.dep" line each, like "build.dep: golang.org/x/sys v0.15.0", with
+// " => " and its replacement if any.
+func build_info_fields( b BuildInfo) (fields []ReportField) {
+    str    := func( s string) string { if (s == "") { return "?"}; return s}
+    add    := func( key string, value string) {
+        fields = append( fields, ReportField{ Key: key, Value: value})
+    }
+
+    add( "build.main",         str( strings.TrimSpace( b.Main_path + " " + b.Main_version)))
+    add( "build.vcs",          str( b.Vcs))
+    add( "build.vcs.revision", str( b.Vcs_revision))
+    add( "build.vcs.time",     str( b.Vcs_time))
+    add( "build.vcs.modified", str( b.Vcs_modified))
+    add( "build.arch_level",   str( b.Arch_level))
+    for _, flag := range b.Build_flags {
+        add( "build.flag", flag)
+    }
+    for _, dep := range b.Deps {
+        value  := dep.Path + " " + dep.Version
+        if (dep.Replace != "") { value += " => " + dep.Replace}
+        add( "build.dep", value)
+    }
+    return fields
+}
+
+// for latlearn's internal use only
+func write_build_info_to_report( w io.Writer, b BuildInfo) {
+    for _, field := range build_info_fields( b) {
+        io.WriteString( w, fmt.Sprintf( "%-29s%s\n", field.Key + ":", field.Value))
+    }
+}
+
+// for latlearn's internal use only
+//
+// The inverse of build_info_fields, for ParseReport. A "?" is unknown.
+func parse_build_info_field( b *BuildInfo, key string, value string) {
+    if (value == "?") { return}
+
+    switch key {
+        case "build.main":
+            b.Main_path, b.Main_version, _ = strings.Cut( value, " ")
+        case "build.vcs":          b.Vcs          = value
+        case "build.vcs.revision": b.Vcs_revision = value
+        case "build.vcs.time":     b.Vcs_time     = value
+        case "build.vcs.modified": b.Vcs_modified = value
+        case "build.flag":         b.Build_flags  = append( b.Build_flags, value)
+        case "build.arch_level":   b.Arch_level   = value
+        case "build.dep":
+            dep, replace, _ := strings.Cut( value, " => ")
+            bd              := BuildDep{ Replace: replace}
+            bd.Path, bd.Version, _ = strings.Cut( dep, " ")
+            b.Deps           = append( b.Deps, bd)
+    }
+}
@@ -0,0 +1,45 @@
+package latlearn_test
+
+import (
+    "bytes"
+    "reflect"
+    "strings"
+    "testing"
+
+    "."
+)
+
+func TestBuildInfoRoundTrip( t *testing.T) {
+    b     := latlearn.BuildInfo{
+                 Main_path: "example.com/app", Main_version: "v1.2.3",
+                 Vcs: "git", Vcs_revision: "0123abcd", Vcs_time: "2024-05-06T07:08:09Z", Vcs_modified: "true",
+                 Build_flags: []string { "-tags=netgo", "-ldflags=-s -w", "-gcflags=all=-N -l", "CGO_ENABLED=0"}, Arch_level: "GOAMD64=v3",
+                 Deps: []latlearn.BuildDep {
+                     { Path: "golang.org/x/sys", Version: "v0.15.0"},
+                     { Path: "example.com/lib", Version: "v0.1.0", Replace: "../lib"}}}
+    rd    := &latlearn.ReportData{ Build: b, Spans: []latlearn.SpanData { span_row( "fn", 100, 10)}}
+
+    var buf bytes.Buffer
+    latlearn.WriteReport( &buf, rd)
+    if !strings.Contains( buf.String(), "build.vcs.revision:          0123abcd\n") ||
+       !strings.Contains( buf.String(), "build.flag:                  -ldflags=-s -w\n") ||
+       !strings.Contains( buf.String(), "build.dep:                   example.com/lib v0.1.0 => ../lib\n") {
+        t.Errorf( "WriteReport: want the build lines, got:\n%s", buf.String())
+    }
+    back, err := latlearn.ParseReport( &buf)
+    if (err != nil) {
+        t.Fatalf( "ParseReport: %v", err)
+    }
+    if !reflect.DeepEqual( back.Build, b) {
+        t.Errorf( "ParseReport: want build %#v, got %#v", b, back.Build)
+    }
+
+    // unknown facts show as "?" and read back as unknown
+    buf.Reset()
+    latlearn.WriteReport( &buf, &latlearn.ReportData{})
+    txt       := buf.String()
+    back, err  = latlearn.ParseReport( &buf)
+    if (err != nil) || !strings.Contains( txt, "build.vcs.revision:          ?\n") || !reflect.DeepEqual( back.Build, latlearn.BuildInfo{}) {
+        t.Errorf( "ParseReport of an unknown build: got %#v, %v", back.Build, err)
+    }
+}
@@ -0,0 +1,55 @@
+// exec_trace.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "runtime/trace"
+)
+
+// Makes span samples visible in Go execution traces (see runtime/trace and
+// go tool trace), named by their span key, like "fn3(n=50)":
+//
+//     "region": B/B2 start a trace.Region, and A/A2 end it. A region must end
+//               on the goroutine which started it, so only use this if every
+//               span's B and A are on the same goroutine
+//     "task":   B/B2 start a trace.Task, and A/A2 end it. A task may end on
+//               any goroutine, and go tool trace shows each task's latency
+//     "":       neither (the default)
+//
+// Only while a trace is being captured: otherwise the cost is one check of
+// trace.IsEnabled. A variant added at A2 (or by Gc_attribution) is logged
+// to the task, under the category "latlearn", as the sample's final key. A
+// span begun with BCtx is nested under any task in its context.
+var Trace_spans string = ""
+
+// for latlearn's internal use only
+//
+// Called before T1 is taken, so is not in the sample.
+func (ssu *SpanSampleUnderway) trace_before() {
+    if !trace.IsEnabled() { return}
+
+    key                := span_key_form( ssu.Name, ssu.Variant)
+    switch Trace_spans {
+        case "region": ssu.trace_region = trace.StartRegion( ssu.base_ctx(), key)
+        case "task":   ssu.span_ctx, ssu.trace_task = trace.NewTask( ssu.base_ctx(), key)
+    }
+    ssu.trace_key       = key
+}
+
+// for latlearn's internal use only
+//
+// Called after T2 is taken, and any end variant added.
+func (ssu *SpanSampleUnderway) trace_after() {
+    if (ssu.trace_region != nil) {
+        ssu.trace_region.End()
+        ssu.trace_region = nil
+    }
+    if (ssu.trace_task != nil) {
+        if key := span_key_form( ssu.Name, ssu.Variant); (key != ssu.trace_key) {
+            trace.Log( ssu.span_ctx, "latlearn", key)
+        }
+        ssu.trace_task.End()
+        ssu.trace_task = nil
+    }
+}
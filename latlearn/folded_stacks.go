@@ -0,0 +1,84 @@
+// folded_stacks.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "fmt"
+    "io"
+    "strings"
+)
+
+// Writes rd's spans in the folded-stack format read by flamegraph.pl (and
+// speedscope, inferno, etc.): one line per stack, its frames joined by ';',
+// then its weight in ns, like:
+//
+//     example-app4;main;big-iloop-iter 1234567
+//
+// A span's frames are the '/' segments of its name. A variant is one frame
+// more, under its parent's, named by its key, like "fn3;fn3(n=50)". As the
+// tools sum each frame's weight from the stacks under it, a line holds only a
+// span's self time: its Cumul less those of the nearest spans under it. This
+// assumes a span named under another one runs within it. Where one does not,
+// its weight still counts, but the outer span's self time stops at 0, so the
+// outer frame looks wider than its Cumul. A segment which is not itself a
+// span, like "main" above, gets only the weight of those under it.
+func WriteFoldedStacks( w io.Writer, rd *ReportData) (err error) {
+    frames     := make( [][]string,    len( rd.Spans))
+    index      := make( map[string]int, len( rd.Spans)) // by the frames, joined
+    for i, sd  := range rd.Spans {
+        frames[ i] = folded_frames( sd)
+        if !sd.Completed { continue}
+        stack     := strings.Join( frames[ i], ";")
+        if _, found := index[ stack]; !found { index[ stack] = i}
+    }
+
+    // each span's Cumul is taken from the self time of the nearest one above
+    // it. a span which never completed has a Cumul of -1, so is left out
+    self       := make( []int64, len( rd.Spans))
+    for i, sd  := range rd.Spans {
+        if !sd.Completed { continue}
+        self[ i] += sd.Cumul
+        for k  := len( frames[ i]) - 1; (k > 0); k-- {
+            if j, found := index[ strings.Join( frames[ i][ :k], ";")]; found {
+                self[ j] -= sd.Cumul
+                break
+            }
+        }
+    }
+
+    // spans whose frames are alike (only if ';' was in their names) share a line
+    for i, sd  := range rd.Spans {
+        if !sd.Completed { continue}
+        stack  := strings.Join( frames[ i], ";")
+        if (index[ stack] != i) {
+            self[ index[ stack]] += self[ i]
+            self[ i]              = 0
+        }
+    }
+    for i      := range rd.Spans {
+        if (self[ i] <= 0) { continue}
+        if _, err = io.WriteString( w, fmt.Sprintf( "%s %d\n", strings.Join( frames[ i], ";"), self[ i])); (err != nil) {
+            return fmt.Errorf( "latlearn.WriteFoldedStacks: %v", err)
+        }
+    }
+    return nil
+}
+
+// for latlearn's internal use only
+//
+// The frames of sd's stack. A ';' in a name would split a frame, so is
+// made a ':'.
+func folded_frames( sd SpanData) (frames []string) {
+    name       := sd.Name
+    if (sd.Parent != "") { name = sd.Parent}
+    name        = strings.ReplaceAll( name, ";", ":")
+    frames      = strings.Split( name, "/")
+
+    if (sd.Parent != "") && strings.HasPrefix( sd.Name, sd.Parent) {
+        // the variant's frame is its key, less the parent's leading segments
+        key    := frames[ len( frames) - 1] + strings.ReplaceAll( sd.Name[ len( sd.Parent):], ";", ":")
+        frames  = append( frames, key)
+    }
+    return frames
+}
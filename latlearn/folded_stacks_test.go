@@ -0,0 +1,39 @@
+package latlearn_test
+
+import (
+    "bytes"
+    "testing"
+
+    "."
+)
+
+func TestWriteFoldedStacks( t *testing.T) {
+    fn_n50       := span_row( "fn3(n=50)", 0, 0)
+    fn_n50.Parent = "fn3"
+    fn_n50.Cumul  = 300
+    rd           := &latlearn.ReportData{ Spans: []latlearn.SpanData {
+                        { Name: "app/main",                Cumul: 1000, Completed: true},
+                        { Name: "app/main/big-iloop-iter", Cumul:  600, Completed: true},
+                        { Name: "app/loader/read",         Cumul:   50, Completed: true},
+                        { Name: "fn3",                     Cumul:  500, Completed: true},
+                        fn_n50,
+                        { Name: "task-537/worker-3",       Cumul:   80, Completed: true},
+                        { Name: "task-537",                Cumul:   20, Completed: true}, // not within its worker's time
+                        { Name: "idle",                    Cumul:    0, Completed: true},
+                        { Name: "app/main/never",          Cumul:   -1, Weight: -1}, // tracked, never completed
+                        { Name: "never",                   Cumul:   -1, Weight: -1}}}
+
+    var buf bytes.Buffer
+    if err := latlearn.WriteFoldedStacks( &buf, rd); (err != nil) {
+        t.Fatalf( "WriteFoldedStacks: want no err, got %v", err)
+    }
+    want := "app;main 400\n" +
+            "app;main;big-iloop-iter 600\n" +
+            "app;loader;read 50\n" +
+            "fn3 200\n" +
+            "fn3;fn3(n=50) 300\n" +
+            "task-537;worker-3 80\n"
+    if (buf.String() != want) {
+        t.Errorf( "WriteFoldedStacks: want:\n%s\ngot:\n%s", want, buf.String())
+    }
+}
@@ -0,0 +1,97 @@
+// gc_attribution.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "runtime"
+    "runtime/metrics"
+    "sync"
+    "time"
+)
+
+// A report can not tell whether a span's Max came from the app's code or from
+// the runtime. So, optionally, each span sample also notes how many GC cycles
+// started, and how much stop-the-world GC pause time passed, between its T1
+// and T2 (see SpanSampleUnderway's Gc_cycles and Gc_pause.) A sample which saw
+// either is learned under the end variant Gc_variant, like with A2. So
+// "fn(gc)" has the GC-affected samples of fn, and the report shows at once
+// how many there were and what they cost. NOTE: The runtime accounts a
+// cycle's pause time as it ends, so a sample which saw only the start of a
+// cycle (one still underway at T2) has its cycle counted, but a Gc_pause of 0.
+//
+// The runtime counts only the cycles completed, so those started are had from
+// the GC's stop-the-world pauses, of which each cycle has two, the first as it
+// starts: started = pauses - completed. A pause is counted just after the
+// world restarts, so for a few µs around each one this may be off by one.
+//
+// It costs two runtime/metrics reads per sample (under a µs), so is off by
+// default. It may be turned on or off at any time: a sample is attributed
+// only if it was on at both B and A.
+var Gc_attribution bool   = false
+var Gc_variant     string = "gc"
+
+// for latlearn's internal use only
+const (
+    gc_cycles_metric = "/gc/cycles/total:gc-cycles"
+    gc_pause_metric  = "/cpu/classes/gc/pause:cpu-seconds" // GOMAXPROCS times the pause time
+    gc_pauses_metric = "/sched/pauses/total/gc:seconds"    // a histogram of each STW pause of the GC
+)
+
+// for latlearn's internal use only
+//
+// So the histogram's memory is reused by later reads, not made anew.
+var gc_samples_pool = sync.Pool{ New: func() any {
+    return &[3]metrics.Sample { { Name: gc_cycles_metric}, { Name: gc_pause_metric}, { Name: gc_pauses_metric}}
+}}
+
+// for latlearn's internal use only
+//
+// The GC cycles started, and the pause time, since the process started.
+// ok is false if this Go version lacks any of the metrics.
+func gc_counters() (started uint64, pause time.Duration, ok bool) {
+    samples := gc_samples_pool.Get().(*[3]metrics.Sample)
+    defer gc_samples_pool.Put( samples)
+
+    metrics.Read( samples[:])
+    if (samples[0].Value.Kind() != metrics.KindUint64) || (samples[1].Value.Kind() != metrics.KindFloat64) ||
+       (samples[2].Value.Kind() != metrics.KindFloat64Histogram) {
+        return 0, 0, false
+    }
+    var pauses uint64
+    for _, n := range samples[2].Value.Float64Histogram().Counts {
+        pauses += n
+    }
+    completed := samples[0].Value.Uint64()
+    if (pauses > completed) { started = pauses - completed}
+    procs     := float64( runtime.GOMAXPROCS( 0))
+    return started, time.Duration( samples[1].Value.Float64() / procs * 1e9), true
+}
+
+// for latlearn's internal use only
+//
+// Notes the GC counters at B. Called before T1 is taken, so the read is not
+// in the sample.
+func (ssu *SpanSampleUnderway) gc_before() {
+    ssu.gc_cycles0, ssu.gc_pause0, ssu.gc_noted = gc_counters()
+}
+
+// for latlearn's internal use only
+//
+// Sets Gc_cycles and Gc_pause, and adds the Gc_variant if either is > 0.
+// Called after T2 is taken.
+func (ssu *SpanSampleUnderway) gc_after() {
+    if !ssu.gc_noted || !Gc_attribution { return}
+
+    started, pause, ok := gc_counters()
+    if !ok { return}
+
+    ssu.Gc_cycles = 0
+    if (started > ssu.gc_cycles0) { ssu.Gc_cycles = int64( started - ssu.gc_cycles0)}
+    ssu.Gc_pause  = pause - ssu.gc_pause0
+    if (ssu.Gc_pause < 0) { ssu.Gc_pause = 0}
+    if ((ssu.Gc_cycles > 0) || (ssu.Gc_pause > 0)) && (Gc_variant != "") {
+        if (ssu.Variant != "") { ssu.Variant += ","}
+        ssu.Variant += Gc_variant
+    }
+}
@@ -0,0 +1,105 @@
+// histogram.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "math/bits"
+    "time"
+)
+
+// Each learner keeps a histogram of its samples, so that percentiles can be
+// known (and stats from different runs merged, or tested for significance.)
+//
+// The buckets are log-linear: every latency under HIST_EXACT ns gets a bucket
+// of its own, then each power of 2 above that is split into HIST_SUB equal
+// sub-buckets. So a bucket is never wider than 1/HIST_SUB (6.25%) of its own
+// low bound, whatever the scale, from ns up to hours. The counts slice only
+// grows as far as the largest bucket seen, so a span of sub-ms latencies
+// costs a few KB at most.
+
+const HIST_SUB_BITS = 4
+const HIST_SUB      = 1 << HIST_SUB_BITS // 16
+const HIST_EXACT    = 2 * HIST_SUB       // 32
+
+// One bucket of a histogram. It counts the samples whose latency (in ns) was
+// in the range [Lo, Hi).
+type HistBucket struct {
+    Lo    int64 `json:"lo"`
+    Hi    int64 `json:"hi"`
+    Count int64 `json:"count"`
+}
+
+// for latlearn's internal use only
+func hist_index( dur time.Duration) (i int) {
+    d         := int64( dur)
+    if (d     <  0)          { return 0}
+    if (d     <  HIST_EXACT) { return int( d)}
+    e         := bits.Len64( uint64( d)) - 1 // d is in [2^e, 2^(e+1))
+    sub       := int( (d >> (e - HIST_SUB_BITS)) & (HIST_SUB - 1))
+    return HIST_EXACT + ((e - (HIST_SUB_BITS + 1)) * HIST_SUB) + sub
+}
+
+// for latlearn's internal use only
+func hist_bounds( i int) (lo int64, hi int64) {
+    if (i < HIST_EXACT) { return int64( i), int64( i + 1)}
+    e         := ((i - HIST_EXACT) / HIST_SUB) + (HIST_SUB_BITS + 1)
+    sub       := int64( (i - HIST_EXACT) % HIST_SUB)
+    width     := int64( 1) << (e - HIST_SUB_BITS)
+    lo         = (int64( 1) << e) + (sub * width)
+    return lo, lo + width
+}
+
+// for latlearn's internal use only
+func (ll *latencyLearner) hist_add( dur time.Duration, count int64) {
+    i         := hist_index( dur)
+    for (len( ll.hist) <= i) {
+        ll.hist = append( ll.hist, 0)
+    }
+    ll.hist[ i] += count
+}
+
+// for latlearn's internal use only
+func (ll *latencyLearner) hist_buckets() (hbs []HistBucket) {
+    for i, count := range ll.hist {
+        if (count == 0) { continue}
+        lo, hi   := hist_bounds( i)
+        hbs       = append( hbs, HistBucket{ Lo: lo, Hi: hi, Count: count})
+    }
+    return hbs
+}
+
+// Estimates the latency (in ns) at quantile q (like 0.99 for p99) from the
+// span's histogram. Within a bucket it interpolates linearly, and the result
+// is clamped to the span's observed Min and Max. Not ok if the span has no
+// histogram (like one read from a text report) or q is not in [0, 1].
+func (sd SpanData) Quantile( q float64) (ns int64, ok bool) {
+    return hist_quantile( sd.Hist, q, sd.Min, sd.Max)
+}
+
+// for latlearn's internal use only
+func hist_quantile( hbs []HistBucket, q float64, min int64, max int64) (ns int64, ok bool) {
+    if (q < 0) || (q > 1) { return -1, false}
+
+    total      := int64( 0)
+    for _, hb  := range hbs {
+        total  += hb.Count
+    }
+    if (total  == 0) { return -1, false}
+
+    rank       := q * float64( total) // how many samples are at or below the answer
+    seen       := int64( 0)
+    for _, hb  := range hbs {
+        if (float64( seen + hb.Count) >= rank) && (hb.Count > 0) {
+            frac := (rank - float64( seen)) / float64( hb.Count)
+            ns    = hb.Lo + int64( frac * float64( hb.Hi - 1 - hb.Lo)) // Hi itself is not in it
+            break
+        }
+        seen   += hb.Count
+        ns      = hb.Hi - 1
+    }
+
+    if (min >= 0) && (ns < min) { ns = min}
+    if (max >= 0) && (ns > max) { ns = max}
+    return ns, true
+}
@@ -10,6 +10,8 @@
 package latlearn
 
 import (
+    "context"
+    "encoding/json"
     "fmt"
     "io"
     "log"
@@ -17,9 +19,12 @@ import (
     "os/exec"
     "runtime"
     "runtime/debug"
+    "runtime/trace"
     "sort"
+    "strconv"
     "strings"
     "sync"
+    "sync/atomic"
     "time"
 )
 
@@ -49,6 +54,9 @@ type latencyLearner struct {
     Max                 time.Duration // int64
     pair_underway       bool
     Pair_ever_completed bool
+    hist                []int64       // sample counts, by hist_index. see histogram.go
+    m2                  float64       // sum of squared deviations from the mean, in ns^2. for the variance
+    ts                  *timeSeries   // nil unless Timeseries_interval is set. see timeseries.go
 }
 
 type variantLatencyLearner struct {
@@ -61,10 +69,29 @@ type SpanSampleUnderway struct {
     Variant string
     T1, T2  time.Time
     Ended   bool      // we rely on this defaulting to false
+
+    Gc_cycles int64         // set at A, only if Gc_attribution. GC cycles which started between T1 and T2
+    Gc_pause  time.Duration // ditto. the GC's stop-the-world pause time between T1 and T2
+
+    gc_cycles0 uint64        // the GC counters at B, if gc_noted
+    gc_pause0  time.Duration
+    gc_noted   bool
+
+    trace_region *trace.Region   // at most one of these is set. see Trace_spans
+    trace_task   *trace.Task
+    trace_key    string          // the span key at B
+
+    ctx          context.Context // from BCtx. nil means context.Background()
+    span_ctx     context.Context // ctx, plus this span's trace task and pprof labels, if any
+    pprof_set    bool
+    goroutine    int64           // the id of the goroutine of B, if needed. see goroutine_of_b
+
+    recorded      bool  // whether Span_recording was on at B
+    rec_depth     int
 }
 
 type ReplyMsg struct {
-    ttype               string // values: "values"
+    ttype               string // values: "values", "series", "snapshot", "span-records"
     Name                string // of tracked span. and learners key. eg: "LL.no-op" or "somefn(N=100)"
     Pair_ever_completed bool
     Min                 time.Duration
@@ -73,11 +100,109 @@ type ReplyMsg struct {
     Mean                int64
     Cumul               time.Duration
     Weight              int
+    Series              []SeriesBucket // only for "series"
+    Report              *ReportData    // only for "snapshot"
+    Records             []SpanRecord   // only for "span-records"
+}
+
+// Facts about the host, under the same normalized names on every platform, so
+// that reports made on different machines (or OSes) can be compared. Zero
+// values mean "unknown" (or for the cgroup limits, "no limit".)
+type HostInfo struct {
+    OS                     string  `json:"os"`         // runtime.GOOS
+    OS_release             string  `json:"os_release"` // like "Ubuntu 22.04.3 LTS" or "macOS 10.15.3"
+    Kernel                 string  `json:"kernel"`
+    Cpu_model              string  `json:"cpu_model"`
+    Cpu_cores              int     `json:"cpu_cores"`   // physical
+    Cpu_threads            int     `json:"cpu_threads"` // logical
+    Cpu_freq_hz            int64   `json:"cpu_freq_hz"` // linux: current scaling freq of cpu0. mac: nominal
+    Cpu_freq_max_hz        int64   `json:"cpu_freq_max_hz"`
+    Cpu_governor           string  `json:"cpu_governor"`
+    Mem_bytes              int64   `json:"mem_bytes"`
+    Page_bytes             int64   `json:"page_bytes"`
+    Cgroup_cpu_limit       float64 `json:"cgroup_cpu_limit"` // in cpus. like 1.5
+    Cgroup_mem_limit_bytes int64   `json:"cgroup_mem_limit_bytes"`
+}
+
+// The machine-readable twin of the plain text report. It is what gets written
+// to Report_json_fpath (if set), and it carries the same facts as the text.
+type ReportData struct {
+    Format                    string     `json:"format"`  // always REPORT_FORMAT
+    Version                   int        `json:"version"` // of this structure
+    Outer_queue_capacity      int        `json:"outer_queue_capacity"`
+    Inner_queue_capacity      int        `json:"inner_queue_capacity"`
+    Overhead_samples_started  bool       `json:"overhead_samples_started"`
+    Overhead_samples_finished bool       `json:"overhead_samples_finished"`
+    Overhead_samples_aborted  bool       `json:"overhead_samples_aborted"`
+    Benchmarks_started        bool       `json:"benchmarks_started"`
+    Benchmarks_finished       bool       `json:"benchmarks_finished"`
+    Benchmarks_aborted        bool       `json:"benchmarks_aborted"`
+    Should_report_builtins    bool       `json:"should_report_builtins"`
+    Should_subtract_overhead  bool       `json:"should_subtract_overhead"`
+    Since_init                int64      `json:"since_init_ns"`
+    Go_version                string     `json:"go_version"`
+    GOARCH                    string     `json:"goarch"`
+    GOOS                      string     `json:"goos"`
+    NumCPU                    int        `json:"num_cpu"`
+    GOMAXPROCS                int        `json:"gomaxprocs"`
+    NumGoroutine              int        `json:"num_goroutine"`
+    Mem_limit                 int64      `json:"mem_limit_bytes"`
+    GOGC                      string     `json:"gogc"`
+    Runtime                   RuntimeMetrics `json:"runtime"`
+    Host                      HostInfo   `json:"host"`
+    Build                     BuildInfo  `json:"build"`
+    Header                    []ReportField `json:"header,omitempty"` // set only by ParseReport. every header line, in order
+    Report_opts               string     `json:"report_opts,omitempty"` // what ApplyReportOpts showed, if anything. see ReportOpts.String
+    Params                    []string   `json:"params"`
+    Meta                      []Param    `json:"meta,omitempty"` // from ReportWith. in the order given
+    Spans                     []SpanData `json:"spans"`
+}
+
+// One row of a report. Latencies are in ns. If Completed is false then no
+// B&A pair has ended yet for the span, and the metrics are all -1.
+type SpanData struct {
+    Name      string  `json:"name"`             // the learners key. like "fn3(n=50)"
+    Parent    string  `json:"parent,omitempty"` // set only for variants. like "fn3"
+    Completed bool    `json:"completed"`
+    Min       int64   `json:"min"`
+    Last      int64   `json:"last"`
+    Max       int64   `json:"max"`
+    Mean      int64   `json:"mean"`
+    Cumul     int64   `json:"cumul"`
+    Weight    int     `json:"weight"`
+    Time_frac float64 `json:"time_frac"`
+    Hist      []HistBucket `json:"hist,omitempty"` // only the non-empty buckets. not overhead compensated
+    Variance  float64 `json:"variance,omitempty"` // sample variance, in ns^2. set only if Weight > 1
+    Series    []SeriesBucket `json:"series,omitempty"` // set only if Timeseries_interval is. oldest first
+}
+
+// a reference task, either built-in or app-defined (registered), run by Benchmarks
+type benchmark struct {
+    span          string // for app-defined ones, already has User_benchmark_prefix on it
+    iterations    int
+    setup         func() // optional. called once, before the iterations. not measured
+    each          func() // optional. called before each iteration. not measured
+    fn            func() // measured, once per iteration
+    teardown      func() // optional. called once, after the iterations. not measured
+}
+
+// Options for BenchmarksCtx. The zero value runs every benchmark with its
+// default iteration count, with no time budget, and no progress callback.
+type BenchmarkOpts struct {
+    Iterations map[string]int // by span, like "LL.sort-strs(n=10)". overrides that benchmark's default count
+    Budget     time.Duration  // if > 0, benchmarks stop once this much time has passed
+    Progress   func( done int, total int, span string) // if set, called after each benchmark. from a latlearn goroutine
 }
 
 type comm_msg struct {
-    ttype         string   // values: "A", "values", "benchmarks", "report", "stop"
+    ttype         string   // values: "A", "values", "benchmarks", "benchmarks-done", "register-benchmark", "report", "save-state", "load-state", "series", "snapshot", "span-records", "stop"
     params        []string // generic yet app-specific, like for report gen
+    meta          []Param  // the same, but as key/value pairs. see ReportWith
+    benchmark     *benchmark
+    bench_ctx     context.Context
+    bench_opts    BenchmarkOpts
+    aborted       bool
+    state         *State   // filled by "save-state", read by "load-state"
 
     // next 4 fields are "value-passed" (or immutable) vars,
     // and which are equiv to a SpanSampleUnderway instance:
@@ -85,6 +210,10 @@ type comm_msg struct {
     t1,   t2      time.Time
     ///////////////////////
 
+    recorded      bool     // if so, also goes in the span ring. see Span_recording
+    goroutine     int64
+    depth         int
+
     done          chan bool
     reply_chan    chan ReplyMsg
 }
@@ -94,8 +223,6 @@ type latencyLearnerI interface {
     getVLL()        *variantLatencyLearner
 
     after2( dur time.Duration) // dur is int64. of ns. legit & precise?
-
-    report( *os.File, string, time.Duration, time.Duration)
 }
 
 type SpanSampleUnderwayI interface {
@@ -120,6 +247,7 @@ var init_completed            bool = false // to be explicit. we rely on this st
 
 var Serve_started             bool = false // to be explicit. we rely on these starting false
 var Serve_finished            bool = false // ditto
+var serve_done                chan struct{} = nil // closed once 'serve' has returned, so no one waits on it forever
 
  // this structure (along with the singleton serve() goroutine) form the "heart" of LatLearn:
 var learners                  map[string]latencyLearnerI
@@ -131,6 +259,8 @@ var tracked_spans             []string
 var Should_report_builtins    bool = true
 var Should_subtract_overhead  bool = false
 var Report_fpath              string = "latlearn-report.txt"
+var Report_json_fpath         string = "" // if set, each report is ALSO written here, as JSON
+var Report_html_fpath         string = "" // if set, each report is ALSO written here, as one self-contained HTML file
 
 var Overhead_samples_started  bool = false
 var Overhead_samples_finished bool = false
@@ -138,9 +268,22 @@ var Overhead_samples_aborted  bool = false
 
 var Benchmarks_started        bool = false
 var Benchmarks_finished       bool = false
+var Benchmarks_aborted        bool = false // cancelled, or ran out of time budget, before all were done
+
+var benchmarks_running        bool = false // owned by the serve goroutine
+
+// app-defined benchmarks get their span names prefixed with this. Only takes
+// effect for benchmarks registered after it is set
+var User_benchmark_prefix     string = "user."
+
+// built/modified ONLY by the serve goroutine. kept in registration order
+var registered_benchmarks     []*benchmark
 
 const OVERHEAD_SPAN = "LL.no-op"
 
+const REPORT_FORMAT         = "latlearn-report"
+const REPORT_FORMAT_VERSION = 1
+
 
 func ( ll *latencyLearner)        getLL()  *latencyLearner        { return  ll}
 func ( ll *latencyLearner)        getVLL() *variantLatencyLearner { return nil}
@@ -149,11 +292,23 @@ func (vll *variantLatencyLearner) getVLL() *variantLatencyLearner { return vll}
 
 // for latlearn's internal use only
 func latency_learner( span string) (ll *latencyLearner, found bool) {
-    lli, found                 := learners[ span]
+    return latency_learner_in( learners, span)
+}
+
+// for latlearn's internal use only
+func variant_latency_learner( span string) (vll *variantLatencyLearner, found bool) {
+    return variant_latency_learner_in( learners, span)
+}
+
+// for latlearn's internal use only
+//
+// Like latency_learner, but of any learners map. (Like one of replay's.)
+func latency_learner_in( lrs map[string]latencyLearnerI, span string) (ll *latencyLearner, found bool) {
+    lli, found                 := lrs[ span]
     if  !found {
         ll                      = new( latencyLearner)
         ll.Name                 = span
-        learners[ span] = ll
+        lrs[ span]              = ll
     } else {
         ll                      = lli.getLL()
     }
@@ -161,14 +316,14 @@ func latency_learner( span string) (ll *latencyLearner, found bool) {
 }
 
 // for latlearn's internal use only
-func variant_latency_learner( span string) (vll *variantLatencyLearner, found bool) {
-    lli, found                 := learners[ span]
+func variant_latency_learner_in( lrs map[string]latencyLearnerI, span string) (vll *variantLatencyLearner, found bool) {
+    lli, found                 := lrs[ span]
     if  !found {
         ll                     := new( latencyLearner)
         ll.Name                 = span
         vll                     = new( variantLatencyLearner)
         vll.latencyLearner      =  ll
-        learners[ span] = vll
+        lrs[ span]              = vll
     } else {
         vll                     = lli.getVLL()
     }
@@ -188,35 +343,49 @@ func handle_ssu_A( name string, variant string, t1 time.Time, t2 time.Time) (ok
 
     dur             := t2.Sub( t1) // time.Duration. int64. of ns. legit & precise
 
+    if !learn_sample( learners, &tracked_spans, name, variant, t2.Sub( init_time), dur) { return false}
+
+    if (sample_log != nil) { sample_log.add( name, variant, t1, dur)}
+    return true
+}
+
+// for internal, latlearn-only, use
+//
+// Feeds one sample, which ended at end (since Init), to its learner in lrs
+// (and, if a variant, to its parent's too) making and tracking them as needed.
+func learn_sample( lrs map[string]latencyLearnerI, tracked *[]string, name string, variant string, end time.Duration, dur time.Duration) (ok bool) {
     if     (variant != "") {
-        parent_key  := span_key_form(           name, "")
-        pll, found  := latency_learner(         parent_key)
+        parent_key  := span_key_form(              name, "")
+        pll, found  := latency_learner_in(         lrs, parent_key)
         if     (pll == nil) { return false}
-        if  !found  { tracked_spans = append( tracked_spans, parent_key)}
+        if  !found  { *tracked = append( *tracked, parent_key)}
 
-        variant_key := span_key_form(           name, variant)
-        vll, found2 := variant_latency_learner( variant_key)
+        variant_key := span_key_form(              name, variant)
+        vll, found2 := variant_latency_learner_in( lrs, variant_key)
         if     (vll == nil) { return false}
-        if  !found2 { tracked_spans = append( tracked_spans, variant_key)}
+        if  !found2 { *tracked = append( *tracked, variant_key)}
 
         vll.parent   = pll // indicates this is variant of parent span, part of family
 
-        if (vll.parent         != nil) { vll.parent.after2(         dur)}
-        if (vll.latencyLearner != nil) { vll.latencyLearner.after2( dur)}
+        if (vll.parent         != nil) { vll.parent.after2(         dur); vll.parent.series_add(         end, dur)}
+        if (vll.latencyLearner != nil) { vll.latencyLearner.after2( dur); vll.latencyLearner.series_add( end, dur)}
 
     } else {
-        key         := span_key_form(           name, "")
-        ll, found   := latency_learner(         key)
+        key         := span_key_form(              name, "")
+        ll, found   := latency_learner_in(         lrs, key)
         if      (ll == nil) { return false}
-        if !found   { tracked_spans = append( tracked_spans, key)}
+        if !found   { *tracked = append( *tracked, key)}
         ll.after2( dur)
+        ll.series_add( end, dur)
     }
     return true
 }
 
 // for internal, latlearn-only, use
 func handle_msg_A( msg comm_msg) (ok bool) {
-    return handle_ssu_A( msg.name, msg.variant, msg.t1, msg.t2)
+    ok = handle_ssu_A( msg.name, msg.variant, msg.t1, msg.t2)
+    if ok && msg.recorded { span_record_add( msg)}
+    return ok
 }
 
 // for internal, latlearn-only, use
@@ -280,21 +449,80 @@ func handle_msg_values( msg comm_msg) {
 func handle_msg_report( msg comm_msg) {
     //log.Printf( "latlearn.handle_msg_report\n")
 
-    report_inner( msg.params)
+    report_inner( msg.params, msg.meta)
+    if (sample_log != nil) { sample_log.flush()} // so the log is readable up to here
 
     if (msg.done != nil) {
         msg.done <- true
     }
 }
 
+// for internal, latlearn-only, use
+func handle_msg_snapshot( msg comm_msg) {
+    if (msg.reply_chan == nil) { return}
+
+    var overhead time.Duration = -1
+    if Should_subtract_overhead {
+        overhead, _ = measure_overhead_estimate()
+    }
+    gogc       := ""
+    if val, ok := os.LookupEnv( "GOGC"); ok { gogc = val}
+
+    rd         := report_data( msg.params, msg.meta, time.Since( init_time), overhead, debug.SetMemoryLimit( -1), gogc, host_info(), runtime_metrics())
+    msg.reply_chan <- ReplyMsg{ ttype: msg.ttype, Report: &rd}
+}
+
 // for internal, latlearn-only, use
 func handle_msg_benchmarks( msg comm_msg) {
     //log.Printf( "latlearn.handle_msg_benchmarks\n")
 
-    benchmarks_inner()
+    if benchmarks_running { // only one set of benchmarks at a time
+        if (msg.done != nil) {
+            msg.done <- false
+        }
+        return
+    }
+    benchmarks_running  = true
+    Benchmarks_started  = true
+    Benchmarks_finished = false
+    Benchmarks_aborted  = false
+
+    learners_copy      := make( map[string]latencyLearnerI, len( learners))
+    for k, v           := range learners {
+        learners_copy[ k] = v
+    }
+    bs                 := benchmarks_builtin( learners_copy)
+    bs                  = append( bs, registered_benchmarks...)
+
+    go benchmarks_inner( msg.bench_ctx, msg.bench_opts, bs, msg.done)
+}
+
+// for internal, latlearn-only, use
+func handle_msg_benchmarks_done( msg comm_msg) {
+    benchmarks_running  = false
+    Benchmarks_finished = true
+    Benchmarks_aborted  = msg.aborted
 
     if (msg.done != nil) {
-        msg.done <- true
+        msg.done <- !msg.aborted
+    }
+}
+
+// for internal, latlearn-only, use
+func handle_msg_register_benchmark( msg comm_msg) {
+    ok := true
+    for _, rb := range registered_benchmarks {
+        if (rb.span == msg.benchmark.span) { ok = false}
+    }
+    if ok {
+        registered_benchmarks = append( registered_benchmarks, msg.benchmark)
+        if _, found := latency_learner( msg.benchmark.span); !found {
+            tracked_spans     = append( tracked_spans, msg.benchmark.span)
+        }
+    }
+
+    if (msg.done != nil) {
+        msg.done <- ok
     }
 }
 
@@ -306,7 +534,14 @@ func handle_comm_msg( msg comm_msg) (stop bool) {
         case "A" :     _ = handle_msg_A(          msg)
         case "values":     handle_msg_values(     msg)
         case "benchmarks": handle_msg_benchmarks( msg)
+        case "benchmarks-done": handle_msg_benchmarks_done( msg)
+        case "register-benchmark": handle_msg_register_benchmark( msg)
         case "report":     handle_msg_report(     msg)
+        case "save-state": handle_msg_save_state( msg)
+        case "load-state": handle_msg_load_state( msg)
+        case "series":     handle_msg_series(     msg)
+        case "snapshot":   handle_msg_snapshot(   msg)
+        case "span-records": handle_msg_span_records( msg)
         case "stop":       return true
     }
     return false
@@ -315,7 +550,9 @@ func handle_comm_msg( msg comm_msg) (stop bool) {
 // for internal, latlearn-only, use
 func serve() {
     Serve_started = true
+    defer close( serve_done)
     defer func() { Serve_finished = true}()
+    defer func() { if (sample_log != nil) { sample_log.close()}}()
 
     log.Printf( "latlearn.serve\n")
 
@@ -354,6 +591,12 @@ func init_inner( spans_app []string) (already bool) { // span list should be for
         "LL.map-str-int-get(k=100,key99)",
         "LL.span-map-lookup",             "LL.sort-strs(n=10)",       "LL.log-hellos(n=10)",
         "LL.byte-array-make(n=1)",        "LL.byte-array-make(n=1k)", "LL.byte-array-make(n=100k)",
+        "LL.time-now",                    "LL.atomic-add-int64",      "LL.syscall-getpid",
+        "LL.mutex-lock-unlock(uncontended)",
+        "LL.mutex-lock-unlock(contended)",
+        "LL.chan-ping-pong",              "LL.goroutine-spawn-join",
+        "LL.json-marshal(small-struct)",  "LL.file-write-fsync(n=1k)",
+        "LL.gc-cycle",
         "LL.exec-command(mac,sysctl)",
         "LL.exec-command(mac,pwd)",
         "LL.exec-command(mac,date)",
@@ -367,6 +610,13 @@ func init_inner( spans_app []string) (already bool) { // span list should be for
         "LL.exec-command(mac,sleep=0.001s)",
         "LL.exec-command(mac,sleep=0.0001s)",
         "LL.exec-command(mac,sh-version)",
+        "LL.exec-command(linux,true)",
+        "LL.exec-command(linux,uname)",
+        "LL.exec-command(linux,date)",
+        "LL.exec-command(linux,sleep=0.01s)",
+        "LL.exec-command(linux,sleep=0.001s)",
+        "LL.exec-command(linux,sleep=0.0001s)",
+        "LL.exec-command(linux,sh-c-noop)",
         "LL.benchmarks-total",            "LL.lat-report"}
 
     spans       := []string {}
@@ -396,8 +646,12 @@ func init_inner( spans_app []string) (already bool) { // span list should be for
 
     comm_outer     = make( chan comm_msg, Outer_queue_capacity)
     comm_inner     = make( chan comm_msg, Inner_queue_capacity)
+    serve_done     = make( chan struct{})
 
     init_time      = time.Now()
+    runtime_metrics_at_init = read_runtime_metrics()
+
+    if (Sample_log_fpath != "") { sample_log = sample_log_open( Sample_log_fpath)}
     init_completed = true // TODO consider moving this line to after go serve()
 
     go serve() // <- in a sense, that thread becomes the "beating heart" of LatLearn
@@ -419,6 +673,10 @@ func Init2( spans_app []string) { // span list should be for LLs (parent spans)
 }
 
 func (ssu *SpanSampleUnderway) before() {
+    if Gc_attribution     { ssu.gc_before()}
+    if (Trace_spans != "") { ssu.trace_before()}
+    if Pprof_labels        { ssu.pprof_before()}
+    if Span_recording      { ssu.record_before()}
     ssu.T1 = time.Now()
 }
 
@@ -440,6 +698,29 @@ func B2( name string, variant string) *SpanSampleUnderway {
     return ssu_before( name, variant)
 }
 
+// Like B2, but the context is what A restores the goroutine's pprof labels to
+// (see Pprof_labels), and the parent of its trace task or region (see
+// Trace_spans.) Like the ctx of the enclosing pprof.Do, or of an enclosing
+// span (see SpanSampleUnderway.Ctx.)
+func BCtx( ctx context.Context, name string, variant string) *SpanSampleUnderway {
+    ssu := &SpanSampleUnderway{ Name: name, Variant: variant, ctx: ctx}
+    ssu.before()
+    return ssu
+}
+
+// The context the span was begun with (see BCtx), plus, if set, its pprof
+// label and trace task. So a span begun with it is nested in this one.
+func (ssu *SpanSampleUnderway) Ctx() context.Context {
+    if (ssu.span_ctx != nil) { return ssu.span_ctx}
+    return ssu.base_ctx()
+}
+
+// for latlearn's internal use only
+func (ssu *SpanSampleUnderway) base_ctx() context.Context {
+    if (ssu.ctx != nil) { return ssu.ctx}
+    return context.Background()
+}
+
 // for latlearn's internal use only
 func (ll *latencyLearner) after2( dur time.Duration) { // dur is int64. of ns. legit & precise?
     //log.Printf("latencyLearner.after2: name %s\n", ll.name)
@@ -448,9 +729,17 @@ func (ll *latencyLearner) after2( dur time.Duration) { // dur is int64. of ns. l
     //log.Printf( "%s after : %#v ms\n",         ll.name, t2)
     //log.Printf( "%s dur   : %#v ns precise\n", ll.name, dur) // nanos. (1/1000 of a milli)
 
+    // Welford's update, so the variance is known without keeping the samples
+    mean_prev := 0.0
+    if (ll.Weight > 0) { mean_prev = float64( ll.Cumul) / float64( ll.Weight)}
+
     ll.Last    = dur
     ll.Cumul  += dur
     ll.Weight ++
+    ll.hist_add( dur, 1)
+
+    mean      := float64( ll.Cumul) / float64( ll.Weight)
+    ll.m2     += (float64( dur) - mean_prev) * (float64( dur) - mean)
 
     if ll.Pair_ever_completed {
         if ( dur < ll.Min) {ll.Min = dur}
@@ -472,30 +761,43 @@ func (ssu *SpanSampleUnderway) after() {
     if ssu.T2.IsZero() { // TODO adding this guard adds latency to span LL.no-op. how much?
         ssu.T2 = time.Now()
     }
+    if ssu.gc_noted          { ssu.gc_after()}
+    if ssu.recorded          { ssu.record_after()}
+    if ssu.pprof_set         { ssu.pprof_after()}
+    if (ssu.trace_key != "") { ssu.trace_after()}
 }
 
 // like after_and_submit but does NOT use channels, just updates the LL in the map directly
 func (ssu *SpanSampleUnderway) after_and_update() (ok bool) {
+    ssu.after() // even if not submitted, so its recording, labels & trace are ended
     if !init_completed { return false}
 
-    ssu.after()
-
     return handle_ssu_A( ssu.Name, ssu.Variant, ssu.T1, ssu.T2)
 }
 
 // for latlearn-internal use only
 func (ssu *SpanSampleUnderway) after_and_submit( comm chan comm_msg) (ok bool) {
-    if (!init_completed || Serve_finished) { return false}
-
-    ssu.after()
+    ssu.after() // even if not submitted, so its recording, labels & trace are ended
+    if !init_completed { return false}
+    select {
+        case <- serve_done: return false // like Serve_finished, but safe to read from any goroutine
+        default:
+    }
 
-    comm <- comm_msg{
+    msg := comm_msg{
                 ttype:   "A",
                 name:    ssu.Name,
                 variant: ssu.Variant,
                 t1:      ssu.T1,
-                t2:      ssu.T2}
-    return true
+                t2:      ssu.T2,
+
+                recorded:  ssu.recorded,
+                goroutine: ssu.goroutine,
+                depth:     ssu.rec_depth}
+    select {
+        case comm <- msg:   return true
+        case <- serve_done: return false // Stop was called meanwhile
+    }
 }
 
 func (ssu *SpanSampleUnderway) A() (ok bool) {
@@ -575,154 +877,318 @@ func noop_fn_for_benchmark_calls() {
 }
 
 // for latlearn's internal use only
-func benchmark_exec( name_sub string, exe string, args []string) { // name_sub like "mac,sysctl"
-    for i      := 0; i < 1000; i++ {
-        cmd    := exec.Command( exe, args...)
-        span   := fmt.Sprintf( "LL.exec-command(%s)", name_sub)
-        ll     := ssu_before( span, "")
-        if err := cmd.Run(); (err != nil) {
-            // TODO call variant of after method (and/or with arg) to indicate it failed
-        }
-        ll.after_and_update()
-    }
+func benchmark_exec( name_sub string, exe string, args []string) (b *benchmark) { // name_sub like "mac,sysctl"
+    var cmd *exec.Cmd
+    return &benchmark{
+        span:       fmt.Sprintf( "LL.exec-command(%s)", name_sub),
+        iterations: 1000,
+        each:       func() { cmd = exec.Command( exe, args...)},
+        fn:         func() {
+            if err := cmd.Run(); (err != nil) {
+                // TODO call variant of after method (and/or with arg) to indicate it failed
+            }
+        }}
 }
 
-func benchmarks_inner() (performed bool) {
-    pre :=      "latlearn.benchmarks_inner"
-    log.Printf( "%s\n", pre)
-
-    if !init_completed { return false}
-
-    Benchmarks_started = true
-
-    ll_bt     := ssu_before( "LL.benchmarks-total","")
-
-    for i     := 0; i < 1000; i++ {
-        ll    := ssu_before( "LL.fn-call-return","")
-        noop_fn_for_benchmark_calls()
-        ll.after_and_update()
-    }
-
-    for i     := 0; i < 1000; i++ {
-        ll    := ssu_before( "LL.for-iters(n=1000)","")
-        for j := 0; j < 1000; j++ {
-        }
-        ll.after_and_update()
-    }
-
-    for i     := 0; i < 1000; i++ {
-        ll    := ssu_before( "LL.accum-ints(n=1000)","")
-        v     := 0
-        for j := 0; j < 1000; j++ {
-            v += j
-        }
-        ll.after_and_update()
-    }
-
-    for i    := 0; i < 1000; i++ {
-        ll   := ssu_before( "LL.add-int-literals(n=2)","")
-        a    := (1 + 2)
-        _     = a // make closer to real, and compiler happy
-        ll.after_and_update()
-    }
-
-    for i    := 0; i < 1000; i++ {
-        ll   := ssu_before( "LL.add-str-literals(n=2)","")
-        c    := ("a" + "b")
-        _     = c // make closer to real, and compiler happy
-        ll.after_and_update()
+// for latlearn's internal use only
+//
+// Like benchmark_exec but finds the exe via PATH. If it can't be found then
+// the benchmark is skipped (nil), and its span stays unsampled (??? in reports.)
+func benchmark_exec_lookpath( name_sub string, file string, args []string) (b *benchmark) {
+    exe, err := exec.LookPath( file)
+    if (err != nil) {
+        log.Printf( "latlearn.benchmark_exec_lookpath: skipping %s: %v\n", name_sub, err)
+        return nil
     }
+    return benchmark_exec( name_sub, exe, args)
+}
 
-    for i     := 0; i < 1000; i++ {
-        m     := make( map[string]int)
-        ll    := ssu_before( "LL.map-str-int-set","")
-        m[ "foo"] = 5
-        ll.after_and_update()
-    }
+// for latlearn's internal use only
+//
+// The built-in benchmarks, in the order they are run. The learners_copy is
+// only read, by LL.span-map-lookup, so that benchmark does not have to touch
+// the real learners map from off the serve goroutine.
+func benchmarks_builtin( learners_copy map[string]latencyLearnerI) (bs []*benchmark) {
+    pre       := "latlearn.benchmarks_builtin"
+
+    bs         = append( bs,
+        &benchmark{ span: "LL.fn-call-return",        iterations: 1000, fn: noop_fn_for_benchmark_calls},
+        &benchmark{ span: "LL.for-iters(n=1000)",     iterations: 1000, fn: func() {
+            for j := 0; j < 1000; j++ {
+            }
+        }},
+        &benchmark{ span: "LL.accum-ints(n=1000)",    iterations: 1000, fn: func() {
+            v     := 0
+            for j := 0; j < 1000; j++ {
+                v += j
+            }
+        }},
+        &benchmark{ span: "LL.add-int-literals(n=2)", iterations: 1000, fn: func() {
+            a    := (1 + 2)
+            _     = a // make closer to real, and compiler happy
+        }},
+        &benchmark{ span: "LL.add-str-literals(n=2)", iterations: 1000, fn: func() {
+            c    := ("a" + "b")
+            _     = c // make closer to real, and compiler happy
+        }})
+
+    var m map[string]int
+    bs         = append( bs, &benchmark{
+        span:       "LL.map-str-int-set",
+        iterations: 1000,
+        each:       func() { m = make( map[string]int)},
+        fn:         func() { m[ "foo"] = 5}})
 
     keys    := []string {}
     for   k := 0; k < 100; k++ {
         keys = append( keys, fmt.Sprintf( "key%d",k))
     } // now have a common set of 100 keys, each with a distinct string value. suitable for map
-    for i     := 0; i < 1000; i++ {
-        m     := make( map[string]int)
+    populate := func() {
+        m     = make( map[string]int)
         for _, key := range keys {
             m[ key] = 5
         } // we've populated the map with 100 entries
-        ll    := ssu_before( "LL.map-str-int-get(k=100,key0)","")
-        _ = m[ "key0"]
-        ll.after_and_update()
-        ll     = ssu_before( "LL.map-str-int-get(k=100,key49)","")
-        _ = m[ "key49"]
-        ll.after_and_update()
-        ll     = ssu_before( "LL.map-str-int-get(k=100,key99)","")
-        _ = m[ "key99"]
-        ll.after_and_update()
-    }
-
-    for i    := 0; i < 1000; i++ {
-        ll   := ssu_before( "LL.span-map-lookup","")
-        a, b := learners[ OVERHEAD_SPAN] // TODO ideally use diff span (one guaranteed to always be in the learners map), in case we never sampled for OVERHEAD_SPAN
-        ll.after_and_update()
+    }
+    for _, key := range []string { "key0", "key49", "key99"} {
+        bs     = append( bs, &benchmark{
+            span:       fmt.Sprintf( "LL.map-str-int-get(k=100,%s)", key),
+            iterations: 1000,
+            each:       populate,
+            fn:         func() { _ = m[ key]}})
+    }
+
+    bs         = append( bs, &benchmark{ span: "LL.span-map-lookup", iterations: 1000, fn: func() {
+        a, b := learners_copy[ OVERHEAD_SPAN] // TODO ideally use diff span (one guaranteed to always be in the learners map), in case we never sampled for OVERHEAD_SPAN
         _     = a // yes, is reason why we are doing this
         _     = b // ditto
-    }
+    }})
+
+    strs      := []string { "Zelda", "Hoth", "Abro",  "Daneel", "Tempest", "Cthulhu", "Bonk", "Arky","Ys", "Jude Law"}
+    strs2     := []string {}
+    bs         = append( bs, &benchmark{
+        span:       "LL.sort-strs(n=10)",
+        iterations: 1000,
+        each:       func() {
+            strs2    = []string {}
+            for _, s := range strs {
+                strs2 = append( strs2, s)
+            }
+        },
+        fn:         func() { sort.Strings( strs2)}}) // sorts the given slice in-place
 
-    strs         := []string { "Zelda", "Hoth", "Abro",  "Daneel", "Tempest", "Cthulhu", "Bonk", "Arky","Ys", "Jude Law"}
-    for i        := 0; i < 1000; i++ {
-        strs2    := []string {}
-        for _, s := range strs {
-            strs2 = append( strs2, s)
+    bs         = append( bs, &benchmark{ span: "LL.log-hellos(n=10)", iterations: 1, fn: func() {
+        for i := 0; i < 10; i++ {
+            log.Printf( "%s: log measure test\n", pre)
         }
-        ll   := ssu_before( "LL.sort-strs(n=10)","")
-        sort.Strings( strs2) // sorts the given slice in-place
-        ll.after_and_update()
+    }})
+
+    for _, n  := range []int { 1, 1000, 100000} {
+        name  := map[int]string { 1: "1", 1000: "1k", 100000: "100k"}[ n]
+        bs     = append( bs, &benchmark{
+            span:       fmt.Sprintf( "LL.byte-array-make(n=%s)", name),
+            iterations: 1000,
+            fn:         func() {
+                array := make( []byte, n)
+                _      = array // to quiet the compiler
+            }})
+    }
+
+    bs         = append( bs, &benchmark{ span: "LL.time-now", iterations: 1000, fn: func() {
+        t     := time.Now()
+        _      = t // to quiet the compiler
+    }})
+
+    var counter int64
+    bs         = append( bs, &benchmark{ span: "LL.atomic-add-int64", iterations: 1000, fn: func() {
+        atomic.AddInt64( &counter, 1)
+    }})
+
+    bs         = append( bs, &benchmark{ span: "LL.syscall-getpid", iterations: 1000, fn: func() {
+        pid   := os.Getpid()
+        _      = pid // to quiet the compiler
+    }})
+
+    var mu sync.Mutex
+    lock_unlock := func() {
+        mu.Lock()
+        mu.Unlock()
+    }
+    bs         = append( bs, &benchmark{ span: "LL.mutex-lock-unlock(uncontended)", iterations: 1000, fn: lock_unlock})
+
+    // a few goroutines hammer the same mutex while we measure taking it
+    var contenders_stop int32
+    var contenders      sync.WaitGroup
+    bs         = append( bs, &benchmark{
+        span:       "LL.mutex-lock-unlock(contended)",
+        iterations: 1000,
+        setup:      func() {
+            atomic.StoreInt32( &contenders_stop, 0)
+            for c := 0; c < 4; c++ {
+                contenders.Add( 1)
+                go func() {
+                    defer contenders.Done()
+                    for (atomic.LoadInt32( &contenders_stop) == 0) {
+                        lock_unlock()
+                    }
+                }()
+            }
+        },
+        fn:         lock_unlock,
+        teardown:   func() {
+            atomic.StoreInt32( &contenders_stop, 1)
+            contenders.Wait()
+        }})
+
+    var ping, pong chan int
+    bs         = append( bs, &benchmark{
+        span:       "LL.chan-ping-pong", // one round trip, between 2 goroutines
+        iterations: 1000,
+        setup:      func() {
+            ping  = make( chan int)
+            pong  = make( chan int)
+            go func() {
+                for v := range ping {
+                    pong <- v
+                }
+            }()
+        },
+        fn:         func() {
+            ping <- 1
+            <- pong
+        },
+        teardown:   func() { close( ping)}})
+
+    bs         = append( bs, &benchmark{ span: "LL.goroutine-spawn-join", iterations: 1000, fn: func() {
+        done  := make( chan bool)
+        go func() { done <- true}()
+        <- done
+    }})
+
+    type small_struct struct {
+        Name  string
+        Id    int
+        Score float64
+        Tags  []string
+    }
+    ss        := small_struct{ Name: "Slartboz", Id: 42, Score: 9.5, Tags: []string {"a", "b"}}
+    bs         = append( bs, &benchmark{ span: "LL.json-marshal(small-struct)", iterations: 1000, fn: func() {
+        data, _ := json.Marshal( ss)
+        _      = data // to quiet the compiler
+    }})
+
+    var fsync_dir  string
+    var fsync_file *os.File
+    fsync_buf := make( []byte, 1000)
+    bs         = append( bs, &benchmark{
+        span:       "LL.file-write-fsync(n=1k)",
+        iterations: 100,
+        setup:      func() {
+            dir, err      := os.MkdirTemp( "", "latlearn-bench-")
+            if (err       != nil) { return}
+            fsync_dir      = dir
+            fsync_file, _  = os.Create( dir + "/fsync.dat")
+        },
+        fn:         func() {
+            if (fsync_file == nil) { return}
+            fsync_file.WriteAt( fsync_buf, 0)
+            fsync_file.Sync()
+        },
+        teardown:   func() {
+            if (fsync_file != nil) { fsync_file.Close()}
+            if (fsync_dir  != "")  { os.RemoveAll( fsync_dir)}
+        }})
+
+    // fewer, since each forced GC cycle can take many ms
+    bs         = append( bs, &benchmark{ span: "LL.gc-cycle", iterations: 20, fn: runtime.GC})
+
+    execs     := []*benchmark {}
+    if (runtime.GOOS == "darwin") {
+        execs  = append( execs,
+            benchmark_exec( "mac,sysctl",        "/usr/sbin/sysctl", []string {}),
+            benchmark_exec( "mac,pwd",           "/bin/pwd",         []string {}),
+            benchmark_exec( "mac,date",          "/bin/date",        []string {}),
+            benchmark_exec( "mac,host",          "/usr/bin/host",    []string {}),
+            benchmark_exec( "mac,hostname",      "/bin/hostname",    []string {}),
+            benchmark_exec( "mac,uname",         "/usr/bin/uname",   []string {}),
+            benchmark_exec( "mac,ls",            "/bin/ls",          []string {}),
+            benchmark_exec( "mac,df",            "/bin/df",          []string {}),
+            benchmark_exec( "mac,kill",          "/bin/kill",        []string {}),
+            benchmark_exec( "mac,sleep=0.01s",   "/bin/sleep",       []string {"0.01",}),
+            benchmark_exec( "mac,sleep=0.001s",  "/bin/sleep",       []string {"0.001",}),
+            benchmark_exec( "mac,sleep=0.0001s", "/bin/sleep",       []string {"0.0001",}),
+            benchmark_exec( "mac,sh-version",    "/bin/sh",          []string {"--version",}))
     }
 
-    ll       := ssu_before( "LL.log-hellos(n=10)","")
-    for i    := 0; i < 10; i++ {
-        log.Printf( "%s: log measure test\n", pre)
+    if (runtime.GOOS == "linux") {
+        execs  = append( execs,
+            benchmark_exec_lookpath( "linux,true",          "true",  []string {}),
+            benchmark_exec_lookpath( "linux,uname",         "uname", []string {}),
+            benchmark_exec_lookpath( "linux,date",          "date",  []string {}),
+            benchmark_exec_lookpath( "linux,sleep=0.01s",   "sleep", []string {"0.01",}),
+            benchmark_exec_lookpath( "linux,sleep=0.001s",  "sleep", []string {"0.001",}),
+            benchmark_exec_lookpath( "linux,sleep=0.0001s", "sleep", []string {"0.0001",}),
+            benchmark_exec_lookpath( "linux,sh-c-noop",     "sh",    []string {"-c", ":",}))
     }
-    ll.after_and_update()
 
-    for i     := 0; i < 1000; i++ {
-        ll    := ssu_before( "LL.byte-array-make(n=1)","")
-        array := make( []byte,      1)
-        _      = array // to quiet the compiler
-        ll.after_and_update()
+    for _, b  := range execs {
+        if (b != nil) { bs = append( bs, b)}
+    }
+    return bs
+}
 
-        ll     = ssu_before( "LL.byte-array-make(n=1k)","")
-        array  = make( []byte,   1000)
-        _      = array // to quiet the compiler
-        ll.after_and_update()
+// for latlearn's internal use only
+//
+// Runs on its own goroutine (NOT the serve goroutine) so that apps can keep
+// submitting samples while it works. Hence it submits its own samples over
+// comm_inner, like any other client would, rather than updating learners
+// directly. The benchmarks list was built by the serve goroutine, for us.
+func benchmarks_inner( ctx context.Context, opts BenchmarkOpts, bs []*benchmark, done chan bool) {
+    pre :=      "latlearn.benchmarks_inner"
+    log.Printf( "%s\n", pre)
 
-        ll     = ssu_before( "LL.byte-array-make(n=100k)","")
-        array  = make( []byte, 100000)
-        _      = array // to quiet the compiler
-        ll.after_and_update()
+    started   := time.Now()
+    aborted   := false
+    stopping  := func() bool {
+        if (opts.Budget > 0) && (time.Since( started) > opts.Budget) { return true}
+        select {
+            case <- ctx.Done():  return true
+            case <- serve_done:  return true
+            default:             return false
+        }
     }
 
-    if (runtime.GOOS == "darwin") {
-        benchmark_exec( "mac,sysctl",        "/usr/sbin/sysctl", []string {})
-        benchmark_exec( "mac,pwd",           "/bin/pwd",         []string {})
-        benchmark_exec( "mac,date",          "/bin/date",        []string {})
-        benchmark_exec( "mac,host",          "/usr/bin/host",    []string {})
-        benchmark_exec( "mac,hostname",      "/bin/hostname",    []string {})
-        benchmark_exec( "mac,uname",         "/usr/bin/uname",   []string {})
-        benchmark_exec( "mac,ls",            "/bin/ls",          []string {})
-        benchmark_exec( "mac,df",            "/bin/df",          []string {})
-        benchmark_exec( "mac,kill",          "/bin/kill",        []string {})
-        benchmark_exec( "mac,sleep=0.01s",   "/bin/sleep",       []string {"0.01",})
-        benchmark_exec( "mac,sleep=0.001s",  "/bin/sleep",       []string {"0.001",})
-        benchmark_exec( "mac,sleep=0.0001s", "/bin/sleep",       []string {"0.0001",})
-        benchmark_exec( "mac,sh-version",    "/bin/sh",          []string {"--version",})
-    }
-
-    ll_bt.after_and_update()
+    ll_bt     := ssu_before( "LL.benchmarks-total","")
 
-    Benchmarks_finished = true
+    for bi, b := range bs {
+        n     := b.iterations
+        if v, found := opts.Iterations[ b.span]; found { n = v}
 
-    return true
+        if stopping() { aborted = true; break}
+
+        if (b.setup != nil) { b.setup()}
+        for i := 0; i < n; i++ {
+            if ((i % 10) == 0) && stopping() { aborted = true; break} // checked outside the measured part
+            if (b.each != nil) { b.each()}
+            ll    := ssu_before( b.span, "")
+            b.fn()
+            ll.after_and_submit( comm_inner)
+        }
+        if (b.teardown != nil) { b.teardown()}
+
+        if (opts.Progress != nil) { opts.Progress( bi + 1, len( bs), b.span)}
+        if aborted { break}
+    }
+
+    if aborted {
+        ll_bt.after() // not learned, but its recording, labels & trace are ended
+    } else {
+        ll_bt.after_and_submit( comm_inner)
+    }
+
+    select {
+        case comm_inner <- comm_msg{ ttype: "benchmarks-done", aborted: aborted, done: done}:
+        case <- serve_done: // Stop was called meanwhile. BenchmarksCtx sees it too
+    }
 }
 
 func (ll *latencyLearner) values() ( name string, pair_ever_completed bool, min time.Duration, last time.Duration, max time.Duration, mean int64, cumul time.Duration, weight int) {
@@ -741,7 +1207,7 @@ func (ll *latencyLearner) mean() ( mean_latency int64, weight int) {
 }
 
 // for latlearn's internal use only
-func to_file(              f *os.File, txt string) {
+func to_file(              f io.Writer, txt string) {
     _, _ = io.WriteString( f,          txt + "\n") // TODO error handling
 }
 
@@ -800,56 +1266,89 @@ func overhead_comp( metric_in int64, overhead int64) (metric_out int64) { // "co
 }
 
 // for latlearn's internal use only
-func (ll *latencyLearner) report( f *os.File, name_field string, since_init time.Duration, overhead time.Duration) { // time.Duration is int64 ns
-    line := ""
-
-    if ll.Pair_ever_completed {
-        min              := int64( ll.Min)
-        if (overhead != -1) && (ll.Name != OVERHEAD_SPAN) {
-            min           = overhead_comp( int64( ll.Min),  int64( overhead))
-        }
-        min_txt          := fmt.Sprintf( "%15s", number_grouped( int64( min), ","))
-
-        last             := overhead_comp( int64( ll.Last), int64( overhead))
-        last_txt         := fmt.Sprintf( "%15s", number_grouped( int64( last), ","))
-
-        max              := overhead_comp( int64( ll.Max),  int64( overhead))
-        max_txt          := fmt.Sprintf( "%15s", number_grouped( int64( max), ","))
+//
+// One row of the text report's span table.
+func span_row_txt( name_field string, sd SpanData) (line string) {
+    if sd.Completed {
+        min_txt          := fmt.Sprintf( "%15s", number_grouped( sd.Min,  ","))
+        last_txt         := fmt.Sprintf( "%15s", number_grouped( sd.Last, ","))
+        max_txt          := fmt.Sprintf( "%15s", number_grouped( sd.Max,  ","))
 
         mean_txt         := "???,???,???,???"
         weight_txt       :=     "???,???,???"
         tf_txt           :=        "????????"
-        weight           := ll.Weight
-
-        if (weight        > 0) {
-            cum_ns       := ll.Cumul.Nanoseconds() // int64. ns
-
-            lat_mean     := cum_ns / int64( weight)
 
-            mean         := overhead_comp(         lat_mean, int64(overhead))
-            mean_txt      = number_grouped( int64( mean),   ",")
-
-            weight_txt    = number_grouped( int64( weight), ",")
-            my_frac      := float64( cum_ns) / float64( since_init) // float64. fraction
-            tf_txt        = fmt.Sprintf( "%8f", my_frac)
+        if (sd.Weight     > 0) {
+            mean_txt      = number_grouped( sd.Mean,           ",")
+            weight_txt    = number_grouped( int64( sd.Weight), ",")
+            tf_txt        = fmt.Sprintf( "%8f", sd.Time_frac)
         }
 
         rest_fields := "%15s | %15s | %15s | %15s | w %11s | tf %8s | %-21s"
         format      := name_field + ": " + rest_fields
         line         = fmt.Sprintf(
                            format,
-                           ll.Name,    min_txt, last_txt, max_txt, mean_txt,
-                           weight_txt, tf_txt,  ll.Name)
+                           sd.Name,    min_txt, last_txt, max_txt, mean_txt,
+                           weight_txt, tf_txt,  sd.Name)
+        if (len( sd.Series) > 0) { line += " | " + sparkline( sd.Series, Sparkline_width)}
     } else {
         // min, last, max, mean, weight of mean (# of calls for this span), time fraction (of current time difference since Iinit, in/under this span)
         rest_fields := "???,???,???,??? | ???,???,???,??? | ???,???,???,??? | ???,???,???,??? | w ???,???,??? | tf ???????? | %-21s"
         format      := name_field + ": " + rest_fields
         line         = fmt.Sprintf(
                            format,
-                           ll.Name, ll.Name)
+                           sd.Name, sd.Name)
     }
+    return line
+}
 
-    to_file( f, line)
+// for latlearn's internal use only
+//
+// The same numbers as the report method writes, but as a SpanData struct.
+// Time_frac is of gathered: since_init, plus that of any loaded State.
+func (ll *latencyLearner) span_data( since_init time.Duration, gathered time.Duration, overhead time.Duration) (sd SpanData) {
+    sd.Name      = ll.Name
+    sd.Completed = ll.Pair_ever_completed
+    if !ll.Pair_ever_completed {
+        sd.Min, sd.Last, sd.Max, sd.Mean, sd.Cumul, sd.Weight = -1, -1, -1, -1, -1, -1
+        return sd
+    }
+
+    sd.Min       = int64( ll.Min)
+    if (overhead != -1) && (ll.Name != OVERHEAD_SPAN) {
+        sd.Min   = overhead_comp( int64( ll.Min), int64( overhead))
+    }
+    sd.Last      = overhead_comp( int64( ll.Last), int64( overhead))
+    sd.Max       = overhead_comp( int64( ll.Max),  int64( overhead))
+    sd.Cumul     = ll.Cumul.Nanoseconds()
+    sd.Weight    = ll.Weight
+    sd.Hist      = ll.hist_buckets()
+    sd.Mean      = -1
+    if (ll.Weight > 0) {
+        sd.Mean      = overhead_comp( sd.Cumul / int64( ll.Weight), int64( overhead))
+        sd.Time_frac = float64( sd.Cumul) / float64( gathered)
+    }
+    if (ll.Weight > 1) {
+        sd.Variance  = ll.m2 / float64( ll.Weight - 1)
+    }
+    sd.Series    = ll.series( since_init)
+    return sd
+}
+
+// for latlearn's internal use only
+func report_json( fpath string, rd ReportData) (ok bool) {
+    pre      := "latlearn.report_json"
+
+    data, err := json.MarshalIndent( rd, "", "  ")
+    if (err != nil) {
+        log.Printf( "%s: could not encode report: err %#v\n", pre, err)
+        return false
+    }
+    if err = os.WriteFile( fpath, append( data, '\n'), 0644); (err != nil) {
+        log.Printf( "%s: could not write report: path '%s', err %#v\n", pre, fpath, err)
+        return false
+    }
+    return true
 }
 
 // for latlearn's internal use only
@@ -877,6 +1376,202 @@ func mac_sysctl_report_line( key string, f *os.File) {
     io.WriteString( f, line)
 }
 
+// for latlearn's internal use only
+func mac_sysctl_int( key string) (value int64) {
+    value, err := strconv.ParseInt( mac_sysctl( key), 10, 64)
+    if (err != nil) { return 0}
+    return value
+}
+
+// for latlearn's internal use only
+func mac_host_info( hi *HostInfo) {
+    hi.Kernel         = mac_sysctl(     "kern.version")
+    hi.Cpu_model      = mac_sysctl(     "machdep.cpu.brand_string")
+    hi.Cpu_cores      = int( mac_sysctl_int( "machdep.cpu.core_count"))
+    hi.Cpu_threads    = int( mac_sysctl_int( "machdep.cpu.thread_count"))
+    hi.Cpu_freq_hz    = mac_sysctl_int( "hw.cpufrequency")
+    hi.Mem_bytes      = mac_sysctl_int( "hw.memsize")
+    if   ver         := mac_sysctl(     "kern.osproductversion"); (ver != "") {
+        hi.OS_release = "macOS " + ver
+    }
+}
+
+// for latlearn's internal use only
+func read_trimmed( fpath string) (value string) {
+    data, err := os.ReadFile( fpath)
+    if (err != nil) { return ""}
+    return strings.TrimSpace( string( data))
+}
+
+// for latlearn's internal use only
+func read_int( fpath string) (value int64) {
+    value, err := strconv.ParseInt( read_trimmed( fpath), 10, 64)
+    if (err != nil) { return 0}
+    return value
+}
+
+// for latlearn's internal use only
+//
+// Returns the dir of this process's own cgroup, for the given v1 controller
+// (like "memory") or for the v2 unified hierarchy (when controller is "").
+// Inside most containers this resolves to the cgroup root, which is fine,
+// since that is what the container runtime has mounted for us.
+func linux_cgroup_dir( controller string) (dir string) {
+    root      := "/sys/fs/cgroup"
+    if (controller != "") { root = root + "/" + controller}
+
+    txt       := read_trimmed( "/proc/self/cgroup")
+    for _, line := range strings.Split( txt, "\n") {
+        pcs   := strings.SplitN( line, ":", 3) // like "4:memory:/some/path" (v1) or "0::/some/path" (v2)
+        if (len( pcs) != 3) { continue}
+        for _, c := range strings.Split( pcs[1], ",") {
+            if (c != controller) { continue}
+            if _, err := os.Stat( root + pcs[2]); (err == nil) {
+                return root + pcs[2]
+            }
+        }
+    }
+    return root
+}
+
+// for latlearn's internal use only
+func linux_cgroup_limits( hi *HostInfo) {
+    // cgroup v2
+    if cpu_max := read_trimmed( linux_cgroup_dir( "") + "/cpu.max"); (cpu_max != "") {
+        pcs    := strings.Fields( cpu_max) // like "max 100000" or "200000 100000"
+        if (len( pcs) == 2) && (pcs[0] != "max") {
+            quota,  err1 := strconv.ParseFloat( pcs[0], 64)
+            period, err2 := strconv.ParseFloat( pcs[1], 64)
+            if (err1 == nil) && (err2 == nil) && (period > 0) {
+                hi.Cgroup_cpu_limit = quota / period
+            }
+        }
+        hi.Cgroup_mem_limit_bytes = read_int( linux_cgroup_dir( "") + "/memory.max") // "max" yields 0, which means none
+        return
+    }
+
+    // cgroup v1
+    cpu_dir := linux_cgroup_dir( "cpu")
+    quota   := read_int( cpu_dir + "/cpu.cfs_quota_us") // -1 if no limit
+    period  := read_int( cpu_dir + "/cpu.cfs_period_us")
+    if (quota > 0) && (period > 0) {
+        hi.Cgroup_cpu_limit = float64( quota) / float64( period)
+    }
+    mem     := read_int( linux_cgroup_dir( "memory") + "/memory.limit_in_bytes")
+    if (mem > 0) && (mem < (1 << 62)) { // v1 signals "no limit" with a huge page-aligned number
+        hi.Cgroup_mem_limit_bytes = mem
+    }
+}
+
+// for latlearn's internal use only
+func linux_host_info( hi *HostInfo) {
+    hi.Kernel          = read_trimmed( "/proc/version")
+    hi.OS_release      = linux_os_release()
+
+    threads           := 0
+    cores             := map[string]bool {} // keyed by "physical id/core id"
+    phys_id           := ""
+    for _, line       := range strings.Split( read_trimmed( "/proc/cpuinfo"), "\n") {
+        k, v, found   := strings.Cut( line, ":")
+        if !found { continue}
+        k, v           = strings.TrimSpace( k), strings.TrimSpace( v)
+        switch k {
+            case "processor":   threads++
+            case "model name":  if (hi.Cpu_model == "") { hi.Cpu_model = v}
+            case "Model":       if (hi.Cpu_model == "") { hi.Cpu_model = v} // some ARM kernels
+            case "physical id": phys_id = v
+            case "core id":     cores[ phys_id + "/" + v] = true
+        }
+    }
+    hi.Cpu_threads     = threads
+    hi.Cpu_cores       = len( cores)
+    if (hi.Cpu_cores  == 0) { hi.Cpu_cores = threads} // kernel did not expose topology
+
+    for _, line       := range strings.Split( read_trimmed( "/proc/meminfo"), "\n") {
+        if !strings.HasPrefix( line, "MemTotal:") { continue}
+        pcs           := strings.Fields( line) // like "MemTotal: 16318412 kB"
+        if (len( pcs) >= 2) {
+            kb, err   := strconv.ParseInt( pcs[1], 10, 64)
+            if (err   == nil) { hi.Mem_bytes = kb * 1024}
+        }
+    }
+
+    linux_cgroup_limits( hi)
+
+    hi.Cpu_governor    = read_trimmed( linux_cpufreq_dir + "scaling_governor")
+    hi.Cpu_freq_hz     = read_int(     linux_cpufreq_dir + "scaling_cur_freq") * 1000 // sysfs gives kHz
+    hi.Cpu_freq_max_hz = read_int(     linux_cpufreq_dir + "scaling_max_freq") * 1000
+}
+
+// for latlearn's internal use only
+const linux_cpufreq_dir = "/sys/devices/system/cpu/cpu0/cpufreq/"
+
+// for latlearn's internal use only
+func linux_os_release() (name string) {
+    for _, line := range strings.Split( read_trimmed( "/etc/os-release"), "\n") {
+        if   v, found := strings.CutPrefix( line, "PRETTY_NAME="); found {
+            return strings.Trim( v, "\"")
+        }
+    }
+    return ""
+}
+
+// for latlearn's internal use only
+var (
+    host_info_once   sync.Once
+    host_info_cached HostInfo
+)
+
+// for latlearn's internal use only
+//
+// The host's facts. All but the current CPU freq (on Linux) are static, so
+// are read only once: a Snapshot runs on the serve goroutine, and re-reading
+// them (on macOS, by execs of sysctl) each time would slow the process that
+// Top is watching.
+func host_info() (hi HostInfo) {
+    host_info_once.Do( func() { host_info_cached = host_info_read()})
+    hi            = host_info_cached
+    if (runtime.GOOS == "linux") {
+        hi.Cpu_freq_hz = read_int( linux_cpufreq_dir + "scaling_cur_freq") * 1000
+    }
+    return hi
+}
+
+// for latlearn's internal use only
+func host_info_read() (hi HostInfo) {
+    hi.OS         = runtime.GOOS
+    hi.Page_bytes = int64( os.Getpagesize())
+
+    switch runtime.GOOS {
+        case "darwin": mac_host_info(   &hi)
+        case "linux":  linux_host_info( &hi)
+    }
+    return hi
+}
+
+// for latlearn's internal use only
+func write_host_info_to_report( f io.Writer, hi HostInfo) {
+    str   := func( s string) string { if (s == "") { return "?"}; return s}
+    num   := func( n int64)  string { if (n <= 0)  { return "?"}; return number_grouped( n, ",")}
+
+    cgcpu := "?"
+    if (hi.Cgroup_cpu_limit > 0) { cgcpu = fmt.Sprintf( "%g", hi.Cgroup_cpu_limit)}
+
+    io.WriteString( f, fmt.Sprintf( "host.os:                     %s\n",       str( hi.OS)))
+    io.WriteString( f, fmt.Sprintf( "host.os_release:             %s\n",       str( hi.OS_release)))
+    io.WriteString( f, fmt.Sprintf( "host.kernel:                 %s\n",       str( hi.Kernel)))
+    io.WriteString( f, fmt.Sprintf( "host.cpu_model:              %s\n",       str( hi.Cpu_model)))
+    io.WriteString( f, fmt.Sprintf( "host.cpu_cores:              %s\n",       num( int64( hi.Cpu_cores))))
+    io.WriteString( f, fmt.Sprintf( "host.cpu_threads:            %s\n",       num( int64( hi.Cpu_threads))))
+    io.WriteString( f, fmt.Sprintf( "host.cpu_freq:               %s hz\n",    num( hi.Cpu_freq_hz)))
+    io.WriteString( f, fmt.Sprintf( "host.cpu_freq_max:           %s hz\n",    num( hi.Cpu_freq_max_hz)))
+    io.WriteString( f, fmt.Sprintf( "host.cpu_governor:           %s\n",       str( hi.Cpu_governor)))
+    io.WriteString( f, fmt.Sprintf( "host.mem:                    %s bytes\n", num( hi.Mem_bytes)))
+    io.WriteString( f, fmt.Sprintf( "host.page:                   %s bytes\n", num( hi.Page_bytes)))
+    io.WriteString( f, fmt.Sprintf( "host.cgroup_cpu_limit:       %s cpus\n",  cgcpu))
+    io.WriteString( f, fmt.Sprintf( "host.cgroup_mem_limit:       %s bytes\n", num( hi.Cgroup_mem_limit_bytes)))
+}
+
 // for latlearn's internal use only
 func write_info_about_mac_host_to_report( f *os.File) {
 
@@ -896,7 +1591,7 @@ func write_info_about_mac_host_to_report( f *os.File) {
     mac_sysctl_report_line( "hw.busfrequency",             f)
 }
 
-func report_inner( params []string) (ok bool) {
+func report_inner( params []string, meta []Param) (ok bool) {
     pre :=      "latlearn.report_inner"
     //log.Printf( "%s\n", pre)
 
@@ -924,6 +1619,7 @@ func report_inner( params []string) (ok bool) {
 
     io.WriteString( f, fmt.Sprintf( "Benchmarks_started:          %v\n", Benchmarks_started))
     io.WriteString( f, fmt.Sprintf( "Benchmarks_finished:         %v\n", Benchmarks_finished))
+    io.WriteString( f, fmt.Sprintf( "Benchmarks_aborted:          %v\n", Benchmarks_aborted))
 
     io.WriteString( f, fmt.Sprintf( "Should_report_builtins:      %v\n", Should_report_builtins))
 
@@ -931,6 +1627,10 @@ func report_inner( params []string) (ok bool) {
     if Should_subtract_overhead {
         io.WriteString( f, fmt.Sprintf("metric treated as overhead:  %s, min\n", OVERHEAD_SPAN))
     }
+    opts_err   := Report_opts.check()
+    if (opts_err == nil) && (Report_opts.String() != "") {
+        io.WriteString( f, fmt.Sprintf( "Report_opts:                 %s\n", Report_opts))
+    }
 
     t2         := time.Now()         // time.Time
     since_init := t2.Sub( init_time) // time.Duration. int64. ns. legit/precise?
@@ -952,6 +1652,12 @@ func report_inner( params []string) (ok bool) {
     gogc := ""
     if val, ok := os.LookupEnv(     "GOGC"); ok {           gogc = val}
     io.WriteString( f, fmt.Sprintf( "GOGC:                        %s\n", gogc))
+    rm := runtime_metrics()
+    write_runtime_metrics_to_report( f, rm)
+
+    hi := host_info()
+    write_host_info_to_report( f, hi)
+    write_build_info_to_report( f, build_info())
 
     if (runtime.GOOS == "darwin") {
         write_info_about_mac_host_to_report( f)
@@ -975,7 +1681,7 @@ func report_inner( params []string) (ok bool) {
     io.WriteString( f, "\n")
 
     // Context Params (which may impact interpretation of the reported span metrics)
-    // TODO prob change the params printout to just one K:V pair per line
+    // (for one key/value param per line, see ReportWith)
     for i, param      := range params {
         txt           := ""
         if         (i == 0) {
@@ -991,10 +1697,24 @@ func report_inner( params []string) (ok bool) {
         io.WriteString( f, "\n")
     }
     io.WriteString(     f, "\n")
+    write_meta_to_report( f, meta)
+
+    var overhead time.Duration = -1 // this value signals that we have no usable estimate
+    if Should_subtract_overhead {
+        overhead, _ = measure_overhead_estimate()
+    }
+
+    all_rd       := report_data( params, meta, since_init, overhead, mem_limit, gogc, hi, rm)
+    rd           := &all_rd
+    if (opts_err != nil) {
+        log.Printf( "%s: showing all spans, as Report_opts is bad: %v\n", pre, opts_err)
+    } else {
+        rd, _     = ApplyReportOpts( &all_rd, Report_opts)
+    }
 
     longest_name := -1
-    for _, name  := range tracked_spans {
-        n        := len( name)
+    for _, sd    := range rd.Spans {
+        n        := len( sd.Name)
         if (longest_name    == -1) {
             longest_name     = n
         } else {
@@ -1004,6 +1724,8 @@ func report_inner( params []string) (ok bool) {
         }
     }
 
+    if (longest_name < len( "span")) { longest_name = len( "span")} // as all rows may be filtered out
+
     name_field  := fmt.Sprintf( "%%-%ds", longest_name)
     rest_fields := "%15s | %15s | %15s | %15s | %13s | %11s | %-21s"
     format      := name_field + ": " + rest_fields
@@ -1013,20 +1735,76 @@ func report_inner( params []string) (ok bool) {
                        format,
                        "span", "min (ns)", "last (ns)", "max (ns)", "mean (ns)",
                        "weight (B&As)", "time frac", "span")
+    if (Timeseries_interval > 0) {
+        header += " | mean over time"
+    }
     to_file( f, header)
 
-    var overhead time.Duration = -1 // this value signals that we have no usable estimate
-    if Should_subtract_overhead {
-        overhead, _ = measure_overhead_estimate()
+    for _, sd   := range rd.Spans {
+        to_file( f, span_row_txt( name_field, sd))
     }
 
+    if (Report_json_fpath != "") { report_json( Report_json_fpath, *rd)}
+    if (Report_html_fpath != "") { report_html( Report_html_fpath, *rd)}
+
+    ok = ssu.after_and_update()
+    return ok
+}
+
+// for latlearn's internal use only
+//
+// The same facts as report_inner writes, as a ReportData.
+func report_data( params []string, meta []Param, since_init time.Duration, overhead time.Duration, mem_limit int64, gogc string, hi HostInfo, rm RuntimeMetrics) (rd ReportData) {
+    rd = ReportData {
+        Format:                    REPORT_FORMAT,
+        Version:                   REPORT_FORMAT_VERSION,
+        Outer_queue_capacity:      Outer_queue_capacity,
+        Inner_queue_capacity:      Inner_queue_capacity,
+        Overhead_samples_started:  Overhead_samples_started,
+        Overhead_samples_finished: Overhead_samples_finished,
+        Overhead_samples_aborted:  Overhead_samples_aborted,
+        Benchmarks_started:        Benchmarks_started,
+        Benchmarks_finished:       Benchmarks_finished,
+        Benchmarks_aborted:        Benchmarks_aborted,
+        Should_report_builtins:    Should_report_builtins,
+        Should_subtract_overhead:  Should_subtract_overhead,
+        Since_init:                int64( since_init),
+        Go_version:                runtime.Version(),
+        GOARCH:                    runtime.GOARCH,
+        GOOS:                      runtime.GOOS,
+        NumCPU:                    runtime.NumCPU(),
+        GOMAXPROCS:                runtime.GOMAXPROCS( -1),
+        NumGoroutine:              runtime.NumGoroutine(),
+        Mem_limit:                 mem_limit,
+        GOGC:                      gogc,
+        Runtime:                   rm,
+        Host:                      hi,
+        Build:                     build_info(),
+        Params:                    append( []string {}, params...),
+        Meta:                      append( []Param {}, meta...),
+        Spans:                     []SpanData {}}
+
     for _, span := range tracked_spans {
         if !Should_report_builtins && strings.HasPrefix( span,"LL.") { continue}
-        learners[ span].report( f, name_field, since_init, overhead) // TODO add found-in-map guard
+        lli     := learners[ span]
+        sd      := lli.getLL().span_data( since_init, since_init + loaded_since_init, overhead)
+        if vll  := lli.getVLL(); (vll != nil) && (vll.parent != nil) {
+            sd.Parent = vll.parent.Name
+        }
+        rd.Spans = append( rd.Spans, sd)
     }
+    return rd
+}
 
-    ok = ssu.after_and_update()
-    return ok
+// Returns the same data a Report would write (see ReportData), but writes no
+// files. For a caller which wants the stats in-process, like Top.
+func Snapshot() (rd *ReportData, ok bool) {
+    if (!init_completed || Serve_finished) { return nil, false}
+
+    reply_chan := make( chan ReplyMsg, 1)
+    comm_outer <- comm_msg{ ttype: "snapshot", reply_chan: reply_chan}
+    reply      := <-reply_chan
+    return reply.Report, true
 }
 
 func Report() (ok bool) {
@@ -1054,12 +1832,53 @@ func Report2( params []string) (ok bool) {
 func Benchmarks() (ok bool) {
     //log.Printf( "latlearn.Benchmarks\n")
 
+    return BenchmarksCtx( context.Background(), BenchmarkOpts{})
+}
+
+// Like Benchmarks, but can be cancelled via ctx, or bounded by opts.Budget.
+// The benchmarks run on a goroutine of their own, NOT the serve goroutine, so
+// the app's samples keep being processed meanwhile. Blocks until they are done
+// or stopped. Returns false if they were stopped early (see Benchmarks_aborted),
+// like by Stop, or if another Benchmarks call was already underway.
+func BenchmarksCtx( ctx context.Context, opts BenchmarkOpts) (ok bool) {
     if (!init_completed || Serve_finished) { return false}
 
     done_chan  := make( chan bool, 1)
-    comm_outer <- comm_msg{ ttype: "benchmarks", done:done_chan}
-    <- done_chan
-    return true
+    comm_outer <- comm_msg{ ttype: "benchmarks", bench_ctx:ctx, bench_opts:opts, done:done_chan}
+    select {
+        case ok = <- done_chan: return ok
+        case <- serve_done: // Stop was called meanwhile
+    }
+    select {
+        case ok = <- done_chan: return ok // they finished just before serve did
+        default:
+            Benchmarks_aborted = true
+            return false
+    }
+}
+
+// Adds an app-defined reference task, like "decode one 1KB protobuf", so that
+// reports can compare your spans against units your team already understands.
+// Each later call of Benchmarks will call setup (if non-nil) once, and then
+// measure fn the given number of times (1000 if iterations < 1), under the
+// span User_benchmark_prefix + name. They run after all the built-in "LL."
+// benchmarks, and are listed in reports after them too. Must be called after
+// Init. Returns false if a benchmark by that name was already registered.
+func RegisterBenchmark( name string, iterations int, setup func(), fn func()) (ok bool) {
+    if (!init_completed || Serve_finished) { return false}
+    if (fn == nil)                         { return false}
+
+    if (iterations < 1) { iterations = 1000}
+
+    rb := &benchmark{
+              span:       User_benchmark_prefix + name,
+              iterations: iterations,
+              setup:      setup,
+              fn:         fn}
+
+    done_chan  := make( chan bool, 1)
+    comm_outer <- comm_msg{ ttype: "register-benchmark", benchmark:rb, done:done_chan}
+    return <- done_chan
 }
 
 func Values( span string) (values ReplyMsg, ok bool) {
@@ -1,8 +1,17 @@
 package latlearn_test
 
 import (
+    "bytes"
+    "context"
+    "encoding/json"
     "fmt"
+    "io"
     "os"
+    "reflect"
+    "runtime"
+    "runtime/pprof"
+    "runtime/trace"
+    "strings"
     "testing"
     "time"
 
@@ -92,6 +101,8 @@ func assert_samples_B2( t *testing.T, span string, variant string, vals []int64,
 
 func TestBasic( t *testing.T) {
 
+    latlearn.Sample_log_fpath    = "./latlearn-samples.bin"
+    latlearn.Timeseries_interval = time.Second
     latlearn.Init()
 
     for i := 0; i < 10; i++ {
@@ -190,18 +201,362 @@ func TestBasic( t *testing.T) {
     t.Run("A=2", func(t *testing.T) {
     })*/
 
+    if ok := latlearn.RegisterBenchmark( "noop", 10, nil, func() {}); !ok {
+        t.Errorf( "RegisterBenchmark: want true, got false")
+    }
+    if ok := latlearn.RegisterBenchmark( "noop", 10, nil, func() {}); ok {
+        t.Errorf( "RegisterBenchmark of a dupe: want false, got true")
+    }
+    if rm, ok := latlearn.Values( "user.noop"); !ok || (rm.Name != "user.noop") || rm.Pair_ever_completed {
+        t.Errorf( "Values of a registered benchmark not yet ran: got %v, %#v", ok, rm)
+    }
+
+    // run only the 1st benchmark, with an overridden count, then cancel the rest
+    ctx, cancel   := context.WithCancel( context.Background())
+    progress_seen := 0
+    opts          := latlearn.BenchmarkOpts{
+        Iterations: map[string]int { "LL.fn-call-return": 5},
+        Progress:   func( done int, total int, span string) {
+            progress_seen = done
+            cancel()
+        }}
+    if ok := latlearn.BenchmarksCtx( ctx, opts); ok {
+        t.Errorf( "BenchmarksCtx cancelled: want false, got true")
+    }
+    if !latlearn.Benchmarks_aborted || (progress_seen != 1) {
+        t.Errorf( "BenchmarksCtx cancelled: want aborted after 1, got %v after %d", latlearn.Benchmarks_aborted, progress_seen)
+    }
+    if rm, _ := latlearn.Values( "LL.fn-call-return"); (rm.Weight != 5) {
+        t.Errorf( "BenchmarksCtx Iterations: want weight 5, got %d", rm.Weight)
+    }
+    if rm, _ := latlearn.Values( "LL.benchmarks-total"); rm.Pair_ever_completed {
+        t.Errorf( "BenchmarksCtx cancelled: want no LL.benchmarks-total sample")
+    }
+
+    latlearn.Report_json_fpath = "./latlearn-report.json"
+    runtime.GC() // so the report has a GC cycle, and its pause, since Init
     latlearn.Report()
+    latlearn.Report_json_fpath = ""
 
     if f, err := os.Open( "./latlearn-report.txt"); (err != nil) { // assumes exist, opens for read
         t.Errorf( "failed to open report file. error: %v", err)
     } else {
+        // with series kept, each completed span's row ends in a sparkline, which ParseReport skips
+        rd, err := latlearn.ParseReport( f)
         f.Close()
+        if (err != nil) {
+            t.Errorf( "ParseReport of a report with sparklines: %v", err)
+        } else {
+            for _, sd := range rd.Spans {
+                if (sd.Name == "span3") && ((sd.Weight != 2) || (sd.Mean != 15)) {
+                    t.Errorf( "ParseReport of a report with sparklines: got %#v", sd)
+                }
+            }
+        }
+    }
+    if series, ok := latlearn.Series( "span3"); !ok || (len( series) < 1) || (series[ len( series) - 1].Count != 2) || (series[ len( series) - 1].Sum != 30) {
+        t.Errorf( "Series span3: want the last interval to hold its 2 samples, got %v, %#v", ok, series)
+    }
+    if series, _ := latlearn.Series( "nosuch"); (len( series) != 0) {
+        t.Errorf( "Series of an unknown span: want none, got %#v", series)
+    }
+
+    if snap, ok := latlearn.Snapshot(); !ok || (snap == nil) {
+        t.Errorf( "Snapshot: want a ReportData, got %v, %v", ok, snap)
+    } else {
+        found := false
+        for _, sd := range snap.Spans {
+            if (sd.Name == "span3") { found = (sd.Weight == 2) && (sd.Mean == 15)}
+        }
+        if !found { t.Errorf( "Snapshot: want span3 with its 2 samples, got %#v", snap.Spans)}
+    }
+
+    var rd latlearn.ReportData
+    if data, err := os.ReadFile( "./latlearn-report.json"); (err != nil) {
+        t.Errorf( "failed to read json report file. error: %v", err)
+    } else if err = json.Unmarshal( data, &rd); (err != nil) {
+        t.Errorf( "failed to decode json report file. error: %v", err)
+    }
+    if (rd.Format != latlearn.REPORT_FORMAT) || (rd.Host.OS != runtime.GOOS) {
+        t.Errorf( "json report: want format %s & host.os %s, got %s & %s", latlearn.REPORT_FORMAT, runtime.GOOS, rd.Format, rd.Host.OS)
     }
+    if (rd.Runtime.Gc_cycles < 1) || (rd.Runtime.Heap_goal_bytes <= 0) || (len( rd.Runtime.Gc_pauses) == 0) {
+        t.Errorf( "json report: want the runtime metrics since Init to have a GC, got %#v", rd.Runtime)
+    }
+    if (len( rd.Build.Build_flags) == 0) { // a test binary has no main module, but still has its build settings
+        t.Errorf( "json report: want the build info, got %#v", rd.Build)
+    }
+    found := false
+    for _, sd := range rd.Spans {
+        if (sd.Name == "span3") {
+            p50,  _ := sd.Quantile( 0.5)
+            p100, _ := sd.Quantile( 1)
+            if (len( sd.Hist) != 2) || (p50 != 10) || (p100 != 20) || (sd.Variance != 50) {
+                t.Errorf( "json report span3 histogram: want 2 buckets, p50 10, p100 20 & variance 50, got %#v, %d, %d & %f", sd.Hist, p50, p100, sd.Variance)
+            }
+        }
+        if (sd.Name == "span4(variant1)") {
+            found = true
+            if (sd.Parent != "span4") || (sd.Weight != 2) || (sd.Mean != 15) {
+                t.Errorf( "json report span4(variant1): got %#v", sd)
+            }
+        }
+    }
+    if !found {
+        t.Errorf( "json report: span4(variant1) missing")
+    }
+
+    // the Report above flushed the sample log
+    if data, err := os.ReadFile( "./latlearn-samples.bin"); (err != nil) {
+        t.Errorf( "failed to read sample log. error: %v", err)
+    } else {
+        slr, err  := latlearn.ReadSampleLog( bytes.NewReader( data))
+        if (err != nil) { t.Fatalf( "ReadSampleLog: %v", err)}
+        durs      := []time.Duration {}
+        seq       := uint64( 0)
+        for {
+            s, err := slr.Next()
+            if (err != nil) {
+                if (err != io.EOF) { t.Errorf( "SampleLogReader.Next: want io.EOF at end, got %v", err)}
+                break
+            }
+            if (s.Seq <= seq) { t.Errorf( "sample log: want rising seqs, got %d after %d", s.Seq, seq)}
+            seq    = s.Seq
+            if (s.Key == "span3") { durs = append( durs, s.Dur)}
+            if (s.Name == "span4") && (s.Variant != "variant1") {
+                t.Errorf( "sample log: want span4 samples of variant1, got %#v", s)
+            }
+        }
+        if (len( durs) != 2) || (durs[ 0] != 10) || (durs[ 1] != 20) {
+            t.Errorf( "sample log: want span3 samples of 10 & 20 ns, got %v", durs)
+        }
+
+        slr, _     = latlearn.ReadSampleLog( bytes.NewReader( data[:len( data) - 1])) // as if cut short
+        for {
+            if _, err := slr.Next(); (err != nil) {
+                if (err != io.ErrUnexpectedEOF) { t.Errorf( "SampleLogReader.Next of a cut log: want io.ErrUnexpectedEOF, got %v", err)}
+                break
+            }
+        }
+    }
+
+    var buf bytes.Buffer
+    if err := latlearn.SaveState( &buf); (err != nil) {
+        t.Fatalf( "SaveState: %v", err)
+    }
+    var st latlearn.State
+    if err := json.Unmarshal( buf.Bytes(), &st); (err != nil) || (st.Format != latlearn.STATE_FORMAT) {
+        t.Fatalf( "SaveState: want a decodable %s, got err %v, format %s", latlearn.STATE_FORMAT, err, st.Format)
+    }
+    st.Spans = st.Spans[:0]
+    st.Since_init = int64( 10 * time.Second) // as if from a long run, busy most of it
+    for _, ss := range []latlearn.SpanState {
+        { Name: "loaded-busy",      Completed: true, Last: 8e9, Cumul: 8e9, Weight: 1, Min: 8e9, Max: 8e9},
+        { Name: "span3",            Completed: true, Last: 20, Cumul: 30, Weight: 2, Min: 10, Max: 20, M2: 50,
+          Hist: []latlearn.HistBucket { { Lo: 10, Hi: 11, Count: 1}, { Lo: 20, Hi: 21, Count: 1}}},
+        { Name: "restored(v=1)",    Parent: "restored", Completed: true, Last: 7, Cumul: 14, Weight: 2, Min: 7, Max: 7},
+        { Name: "restored",         Completed: true, Last: 7, Cumul: 14, Weight: 2, Min: 7, Max: 7}} {
+        st.Spans = append( st.Spans, ss)
+    }
+    data, _ := json.Marshal( st)
+    if err := latlearn.LoadState( bytes.NewReader( data)); (err != nil) {
+        t.Fatalf( "LoadState: %v", err)
+    }
+    assert_values( t, "span3",         true, true, 10, 20, 20, 60, 4, 15) // merged onto its own samples
+    assert_values( t, "restored(v=1)", true, true,  7,  7,  7, 14, 2,  7)
+    if rd, ok := latlearn.Snapshot(); ok {
+        for _, sd := range rd.Spans {
+            if (sd.Name == "loaded-busy") && ((sd.Time_frac < 0.7) || (sd.Time_frac > 0.8)) {
+                t.Errorf( "Time_frac after LoadState: want a share of the loaded Since_init too, ~0.8, got %v", sd.Time_frac)
+            }
+        }
+    }
+
+    buf.Reset()
+    latlearn.SaveState( &buf)
+    json.Unmarshal( buf.Bytes(), &st)
+    if (st.Since_init < int64( 10 * time.Second)) {
+        t.Errorf( "SaveState after LoadState: want a Since_init of at least the loaded 10s, got %d ns", st.Since_init)
+    }
+    names := []string {}
+    for _, ss := range st.Spans {
+        names = append( names, ss.Name)
+        if (ss.Name == "restored(v=1)") && (ss.Parent != "restored") {
+            t.Errorf( "SaveState after LoadState: want restored(v=1) parent restored, got '%s'", ss.Parent)
+        }
+        if (ss.Name == "span3") && ((ss.M2 != 100) || (len( ss.Hist) != 2) || (ss.Hist[ 0].Count != 2)) {
+            t.Errorf( "SaveState after LoadState: span3 m2 & hist not merged: %#v", ss)
+        }
+    }
+    if got := strings.Join( names[ len( names) - 2:], ","); (got != "restored,restored(v=1)") {
+        t.Errorf( "SaveState after LoadState: want new spans tracked last, parent first, got %s", got)
+    }
+
     // reaching here without crash, panic or hang is a good sign
 
+    latlearn.Gc_attribution = true
+    gc_ssu := latlearn.B( "gc-span")
+    runtime.GC()
+    gc_ssu.A()
+    latlearn.B( "gc-span").A()
+    latlearn.Gc_attribution = false
+    if (gc_ssu.Gc_cycles < 1) || (gc_ssu.Gc_pause <= 0) || (gc_ssu.Variant != "gc") {
+        t.Errorf( "Gc_attribution: want a GC cycle & pause, and the gc variant, got %d, %v, '%s'", gc_ssu.Gc_cycles, gc_ssu.Gc_pause, gc_ssu.Variant)
+    }
+    if rm, _ := latlearn.Values( "gc-span(gc)"); (rm.Weight < 1) { // the 2nd sample may have seen a GC too
+        t.Errorf( "Gc_attribution: want the GC-affected sample in gc-span(gc), got weight %d", rm.Weight)
+    }
+    if rm, _ := latlearn.Values( "gc-span"); (rm.Weight != 2) {
+        t.Errorf( "Gc_attribution: want both samples in the parent, got %d", rm.Weight)
+    }
+
+    // spans show in an execution trace, by their key, only if Trace_spans is set
+    var trace_buf bytes.Buffer
+    if err := trace.Start( &trace_buf); (err != nil) {
+        t.Errorf( "trace.Start: %v", err)
+    } else {
+        latlearn.B( "untraced-span").A()
+        latlearn.Trace_spans = "task"
+        latlearn.B2( "traced-task", "n=1").A2( "slow")
+        latlearn.Trace_spans = "region"
+        latlearn.B( "traced-region").A()
+        latlearn.Trace_spans = ""
+        trace.Stop()
+        for _, want := range []string { "traced-task(n=1)", "traced-task(n=1,slow)", "traced-region"} {
+            if !bytes.Contains( trace_buf.Bytes(), []byte( want)) {
+                t.Errorf( "Trace_spans: want '%s' in the execution trace", want)
+            }
+        }
+        if bytes.Contains( trace_buf.Bytes(), []byte( "untraced-span")) {
+            t.Errorf( "Trace_spans off: want no 'untraced-span' in the execution trace")
+        }
+    }
+
+    // a goroutine started within a span inherits its pprof label. one started after A does not
+    latlearn.Pprof_labels = true
+    app_ctx  := pprof.WithLabels( context.Background(), pprof.Labels( "app", "test"))
+    outer    := latlearn.BCtx( app_ctx, "pprof-span", "")
+    inner    := latlearn.BCtx( outer.Ctx(), "pprof-inner", "n=1")
+    v1, _    := pprof.Label( inner.Ctx(), latlearn.PPROF_LABEL_KEY)
+    v2, _    := pprof.Label( inner.Ctx(), "app")
+    if (v1 != "pprof-inner(n=1)") || (v2 != "test") {
+        t.Errorf( "Pprof_labels: want the inner span's ctx to have its label & the app's, got '%s' & '%s'", v1, v2)
+    }
+    inner.A() // back to the outer span's labels
+    release  := make( chan bool)
+    go func() { <-release}()
+    outer.A() // back to the app's
+    go func() { <-release}()
+    latlearn.Pprof_labels = false
+    var gbuf bytes.Buffer
+    pprof.Lookup( "goroutine").WriteTo( &gbuf, 1)
+    close( release)
+    if n := strings.Count( gbuf.String(), `"latlearn_span":"pprof-span"`); (n != 1) {
+        t.Errorf( "Pprof_labels: want 1 goroutine labeled by pprof-span, got %d, in:\n%s", n, gbuf.String())
+    }
+    if n := strings.Count( gbuf.String(), `"app":"test"`); (n != 3) { // both, & this one
+        t.Errorf( "Pprof_labels: want 3 goroutines with the app's label, got %d", n)
+    }
+    pprof.SetGoroutineLabels( context.Background())
+
+    // a span never ended within another does not outlive it
+    latlearn.Pprof_labels = true
+    abandoner   := latlearn.B( "pprof-abandoner")
+    latlearn.B( "pprof-abandoned") // like one left by an early return
+    abandoner.A()
+    for i := 0; (i < 3); i++ {
+        latlearn.B( "pprof-work").A()
+    }
+    release3    := make( chan bool)
+    go func() { <-release3}()
+    latlearn.Pprof_labels = false
+    gbuf.Reset()
+    pprof.Lookup( "goroutine").WriteTo( &gbuf, 1)
+    close( release3)
+    if strings.Contains( gbuf.String(), "pprof-abandon") || strings.Contains( gbuf.String(), "pprof-work") {
+        t.Errorf( "Pprof_labels: want no labels left after a span with one never ended within it, in:\n%s", gbuf.String())
+    }
+
+    // nested plain Bs: the inner span's A brings back the outer's label, and the outer's none
+    latlearn.Pprof_labels = true
+    plain_outer := latlearn.B( "pprof-plain-outer")
+    plain_inner := latlearn.B2( "pprof-plain-inner", "n=2")
+    if v, _ := pprof.Label( plain_inner.Ctx(), latlearn.PPROF_LABEL_KEY); (v != "pprof-plain-inner(n=2)") {
+        t.Errorf( "Pprof_labels: want the nested span's own label, got '%s'", v)
+    }
+    plain_inner.A()
+    release2    := make( chan bool)
+    go func() { <-release2}()
+    plain_outer.A()
+    go func() { <-release2}()
+    latlearn.Pprof_labels = false
+    gbuf.Reset()
+    pprof.Lookup( "goroutine").WriteTo( &gbuf, 1)
+    close( release2)
+    if n := strings.Count( gbuf.String(), `"latlearn_span":"pprof-plain-outer"`); (n != 1) || strings.Contains( gbuf.String(), "pprof-plain-inner") {
+        t.Errorf( "Pprof_labels: want 1 goroutine labeled by pprof-plain-outer, after the nested A, and none by the inner, got %d, in:\n%s", n, gbuf.String())
+    }
+
+    // only spans begun while recording are recorded, each with its nesting on its goroutine
+    rec_untouched := latlearn.B( "rec-before")
+    latlearn.Span_recording = true
+    rec_outer     := latlearn.B( "rec-outer")
+    rec_inner     := latlearn.B2( "rec-inner", "n=1")
+    rec_inner.A2( "slow")
+    rec_outer.A()
+    latlearn.Span_recording = false
+    rec_untouched.A()
+    recs, ok := latlearn.SpanRecords()
+    if !ok {
+        t.Errorf( "SpanRecords: want ok")
+    }
+    got      := map[string]latlearn.SpanRecord {}
+    for _, r := range recs {
+        got[ r.Name] = r
+    }
+    r_out, r_in := got[ "rec-outer"], got[ "rec-inner"]
+    if _, found := got[ "rec-before"]; found || (len( recs) != 2) {
+        t.Errorf( "Span_recording: want only the 2 spans begun while on, got %v", recs)
+    }
+    if (r_out.Depth != 0) || (r_in.Depth != 1) || (r_in.Variant != "n=1,slow") || (r_in.Goroutine == 0) || (r_in.Goroutine != r_out.Goroutine) || r_in.T1.Before( r_out.T1) {
+        t.Errorf( "Span_recording: want rec-inner nested in rec-outer, on the same goroutine, got %#v & %#v", r_in, r_out)
+    }
+
+    meta := []latlearn.Param { { Key: "N", Value: "100"}, { Key: "commit", Value: "abc123"}}
+    if ok := latlearn.ReportWith( meta); !ok {
+        t.Errorf( "ReportWith: want true, got false")
+    }
+    if data, err := os.ReadFile( "./latlearn-report.txt"); (err != nil) {
+        t.Errorf( "ReportWith: %v", err)
+    } else if !strings.Contains( string( data), "params:\n  N:      100\n  commit: abc123\n") {
+        t.Errorf( "ReportWith: want the params aligned, one per line, got:\n%s", data)
+    } else if rd, err := latlearn.ParseReport( bytes.NewReader( data)); (err != nil) || !reflect.DeepEqual( rd.Meta, meta) {
+        t.Errorf( "ParseReport of a ReportWith report: want %v, got %v", meta, err)
+    }
+
+    // Stop while benchmarks run must not leave them, or their caller, blocked
+    latlearn.RegisterBenchmark( "slow", 1000, nil, func() { time.Sleep( time.Millisecond)})
+    first_done   := make( chan bool, 1)
+    bench_result := make( chan bool, 1)
+    go func() {
+        bench_result <- latlearn.BenchmarksCtx( context.Background(), latlearn.BenchmarkOpts{
+            Progress: func( done int, total int, span string) { if (done == 1) { first_done <- true}}})
+    }()
+    <-first_done
     if ok := latlearn.Stop(); !ok {
         t.Errorf( "Stop() failed: want true, got false")
     }
+    select {
+        case ok := <-bench_result:
+            if ok || !latlearn.Benchmarks_aborted {
+                t.Errorf( "Stop during Benchmarks: want false & aborted, got %v & %v", ok, latlearn.Benchmarks_aborted)
+            }
+        case <-time.After( 10 * time.Second):
+            t.Errorf( "Stop during Benchmarks: want BenchmarksCtx to return, but it is still blocked")
+    }
+    if ok := latlearn.B( "after-stop").A(); ok {
+        t.Errorf( "A after Stop: want false, got true")
+    }
     // TODO multiple stop requests
 }
 
@@ -0,0 +1,124 @@
+// merge.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+// Combines the stats of several States (like one per test shard, or per
+// service replica) into one, span by span, as if one process had seen every
+// sample: Cumuls and Weights are summed, the least Min and greatest Max
+// kept, and the histograms and variances combined. Spans are in the order
+// first seen across the inputs. Each input becomes a Source of the result
+// (or, if it was itself a merge, its Sources do) and each span lists which
+// Sources sampled it. Since_init is the sum of the inputs', and Saved_at the
+// latest of them. Meta holds only the params (see ReportWith) which every
+// input has, with the same value. The inputs are not changed.
+func Merge( snapshots ...*State) (merged *State) {
+    merged    = &State{ Format: STATE_FORMAT, Version: STATE_FORMAT_VERSION, Label: "merge"}
+
+    lls      := map[string]*latencyLearner {}
+    parents  := map[string]string {}
+    sources  := map[string][]int {}
+    names    := []string {}
+    first    := true
+
+    for _, st := range snapshots {
+        if (st == nil) { continue}
+
+        if first {
+            merged.Meta = append( []Param {}, st.Meta...)
+            first       = false
+        } else {
+            shared     := []Param {}
+            for _, p   := range merged.Meta {
+                if v, found := ParamValue( st.Meta, p.Key); found && (v == p.Value) { shared = append( shared, p)}
+            }
+            merged.Meta = shared
+        }
+
+        // where this input's sources start, in merged.Sources
+        offset   := len( merged.Sources)
+        if (len( st.Sources) > 0) {
+            merged.Sources = append( merged.Sources, st.Sources...)
+        } else {
+            merged.Sources = append( merged.Sources, Source{ Label: st.Label, Saved_at: st.Saved_at, Since_init: st.Since_init, Meta: st.Meta})
+        }
+        merged.Since_init += st.Since_init
+        if st.Saved_at.After( merged.Saved_at) { merged.Saved_at = st.Saved_at}
+
+        for _, ss := range st.Spans {
+            ll, found := lls[ ss.Name]
+            if !found {
+                ll           = &latencyLearner{ Name: ss.Name}
+                lls[ ss.Name] = ll
+                names        = append( names, ss.Name)
+            }
+            if (parents[ ss.Name] == "") { parents[ ss.Name] = ss.Parent}
+            ll.absorb( ss)
+
+            if !ss.Completed || (ss.Weight < 1) { continue}
+            idxs     := []int { offset}
+            if (len( st.Sources) > 0) {
+                idxs  = []int {}
+                for _, i := range ss.Sources {
+                    idxs = append( idxs, offset + i)
+                }
+            }
+            sources[ ss.Name] = append( sources[ ss.Name], idxs...)
+        }
+    }
+
+    for _, name := range names {
+        ss       := lls[ name].span_state()
+        ss.Parent  = parents[ name]
+        ss.Sources = sources[ name]
+        merged.Spans = append( merged.Spans, ss)
+    }
+    return merged
+}
+
+// Makes a State from a report, so that reports can be merged too. Reports
+// have no M2 but JSON ones have the variance, from which it is recovered.
+// Text reports have neither that nor histograms, so a merge of them knows
+// only the sums, mins and maxes. NOTE: If the report was made with
+// Should_subtract_overhead, its Mins, Lasts and Maxes were compensated. A
+// JSON report's Cumuls never are, but a text report's are too, as
+// ParseReport rebuilds them from the compensated Mean. So such a text report
+// should not be merged with raw inputs: States, JSON reports, or text ones
+// made without Should_subtract_overhead.
+func StateOfReport( rd *ReportData, label string) (st *State) {
+    st         = &State{ Format: STATE_FORMAT, Version: STATE_FORMAT_VERSION, Since_init: rd.Since_init, Label: label, Meta: rd.Meta}
+    for _, sd := range rd.Spans {
+        ss    := SpanState{ Name: sd.Name, Parent: sd.Parent, Completed: sd.Completed}
+        if sd.Completed {
+            ss.Last, ss.Cumul, ss.Weight, ss.Min, ss.Max = sd.Last, sd.Cumul, sd.Weight, sd.Min, sd.Max
+            ss.Hist = sd.Hist
+            if (sd.Weight > 1) { ss.M2 = sd.Variance * float64( sd.Weight - 1)}
+        }
+        st.Spans = append( st.Spans, ss)
+    }
+    return st
+}
+
+// Makes a report from a State, like a merged one, so that it can be read by
+// the same tools as any report (latlearn-diff, latlearn-gate, ...) Only the
+// span rows and the Meta are filled, with Time_frac relative to the State's
+// Since_init.
+// The header fields, which describe one process, are left empty.
+func ReportOfState( st *State) (rd *ReportData) {
+    rd         = &ReportData{ Format: REPORT_FORMAT, Version: REPORT_FORMAT_VERSION, Since_init: st.Since_init, Meta: st.Meta}
+    for _, ss := range st.Spans {
+        sd    := SpanData{ Name: ss.Name, Parent: ss.Parent, Completed: ss.Completed && (ss.Weight > 0)}
+        if !sd.Completed {
+            sd.Min, sd.Last, sd.Max, sd.Mean, sd.Cumul, sd.Weight = -1, -1, -1, -1, -1, -1
+            rd.Spans = append( rd.Spans, sd)
+            continue
+        }
+        sd.Min, sd.Last, sd.Max, sd.Cumul, sd.Weight = ss.Min, ss.Last, ss.Max, ss.Cumul, ss.Weight
+        sd.Mean  = ss.Cumul / int64( ss.Weight)
+        sd.Hist  = ss.Hist
+        if (st.Since_init > 0) { sd.Time_frac = float64( ss.Cumul) / float64( st.Since_init)}
+        if (ss.Weight > 1)     { sd.Variance  = ss.M2 / float64( ss.Weight - 1)}
+        rd.Spans = append( rd.Spans, sd)
+    }
+    return rd
+}
@@ -0,0 +1,62 @@
+package latlearn_test
+
+import (
+    "testing"
+
+    "."
+)
+
+func TestMerge( t *testing.T) {
+    // shard a saw 10 & 20, shard b saw 30 & 40. all four have an M2 of 500
+    a := &latlearn.State{ Label: "shard-a", Since_init: 1000, Spans: []latlearn.SpanState {
+             { Name: "fn3",       Completed: true, Last: 20, Cumul: 30, Weight: 2, Min: 10, Max: 20, M2: 50,
+               Hist: []latlearn.HistBucket { { Lo: 10, Hi: 11, Count: 1}, { Lo: 20, Hi: 21, Count: 1}}},
+             { Name: "only-a",    Completed: true, Last: 5, Cumul: 5, Weight: 1, Min: 5, Max: 5},
+             { Name: "never"}}}
+    b := &latlearn.State{ Label: "shard-b", Since_init: 3000, Spans: []latlearn.SpanState {
+             { Name: "fn3(n=50)", Parent: "fn3", Completed: true, Last: 40, Cumul: 70, Weight: 2, Min: 30, Max: 40, M2: 50},
+             { Name: "fn3",       Completed: true, Last: 40, Cumul: 70, Weight: 2, Min: 30, Max: 40, M2: 50,
+               Hist: []latlearn.HistBucket { { Lo: 30, Hi: 31, Count: 1}, { Lo: 40, Hi: 41, Count: 1}}}}}
+
+    m := latlearn.Merge( a, b)
+
+    if (len( m.Sources) != 2) || (m.Sources[ 1].Label != "shard-b") || (m.Since_init != 4000) {
+        t.Errorf( "Merge: want 2 sources & since_init 4000, got %#v, %d", m.Sources, m.Since_init)
+    }
+    names := []string {}
+    for _, ss := range m.Spans {
+        names = append( names, ss.Name)
+    }
+    if (len( names) != 4) || (names[ 3] != "fn3(n=50)") {
+        t.Fatalf( "Merge: want spans in first-seen order, got %v", names)
+    }
+
+    fn3 := m.Spans[ 0]
+    if (fn3.Cumul != 100) || (fn3.Weight != 4) || (fn3.Min != 10) || (fn3.Max != 40) || (fn3.M2 != 500) || (len( fn3.Hist) != 4) {
+        t.Errorf( "Merge fn3: got %#v", fn3)
+    }
+    if (len( fn3.Sources) != 2) || (len( m.Spans[ 1].Sources) != 1) || (m.Spans[ 2].Sources != nil) {
+        t.Errorf( "Merge provenance: got %v, %v & %v", fn3.Sources, m.Spans[ 1].Sources, m.Spans[ 2].Sources)
+    }
+    if (m.Spans[ 3].Parent != "fn3") || (m.Spans[ 3].Sources[ 0] != 1) {
+        t.Errorf( "Merge fn3(n=50): got %#v", m.Spans[ 3])
+    }
+
+    // a merge of a merge keeps the original sources
+    c  := &latlearn.State{ Label: "shard-c", Spans: []latlearn.SpanState {
+              { Name: "fn3", Completed: true, Last: 1, Cumul: 1, Weight: 1, Min: 1, Max: 1}}}
+    m2 := latlearn.Merge( c, m)
+    if (len( m2.Sources) != 3) || (m2.Sources[ 2].Label != "shard-b") || (len( m2.Spans[ 0].Sources) != 3) || (m2.Spans[ 0].Min != 1) {
+        t.Errorf( "Merge of a merge: got sources %#v, fn3 %#v", m2.Sources, m2.Spans[ 0])
+    }
+
+    rd  := latlearn.ReportOfState( m)
+    sd  := rd.Spans[ 0]
+    if (sd.Mean != 25) || (sd.Time_frac != 0.025) || (sd.Variance != 500.0 / 3) || rd.Spans[ 2].Completed {
+        t.Errorf( "ReportOfState: got %#v", rd.Spans)
+    }
+    back := latlearn.StateOfReport( rd, "again").Spans[ 0]
+    if (back.M2 != 500) || (back.Cumul != 100) || (back.Weight != 4) {
+        t.Errorf( "StateOfReport: got %#v", back)
+    }
+}
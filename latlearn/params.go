@@ -0,0 +1,103 @@
+// params.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+)
+
+// One context param of a report, like N=100, cores=8 or dataset=small. Unlike
+// Report2's strings, tools can look them up by key (see ParamValue), like to
+// diff or merge only runs alike in some of them. The Key should have no ':'.
+type Param struct {
+    Key   string `json:"key"`
+    Value string `json:"value"`
+}
+
+// Returns m as Params, ordered by key.
+func ParamsOf( m map[string]string) (params []Param) {
+    for k, v  := range m {
+        params = append( params, Param{ Key: k, Value: v})
+    }
+    sort.Slice( params, func( i, j int) bool { return params[ i].Key < params[ j].Key})
+    return params
+}
+
+// The value of the first param with key, if any.
+func ParamValue( params []Param, key string) (value string, found bool) {
+    for _, p := range params {
+        if (p.Key == key) { return p.Value, true}
+    }
+    return "", false
+}
+
+// Like Report, but with context params, which are in the text report one per
+// line, aligned, and in the JSON report as a "meta" list, in the order given.
+func ReportWith( meta []Param) (ok bool) {
+    if (!init_completed || Serve_finished) { return false}
+
+    done_chan  := make( chan bool, 1)
+    comm_outer <- comm_msg{ ttype: "report", meta: append( []Param {}, meta...), done: done_chan}
+    <- done_chan
+    return true
+}
+
+// A context param which differs between two reports.
+type ParamDiff struct {
+    Key  string
+    A, B string // "" if not in that report
+    In_a bool
+    In_b bool
+}
+
+// The params of a and b which differ: in value, or by being in only one.
+// In a's order, then those only in b, in b's.
+func DiffParams( a []Param, b []Param) (diffs []ParamDiff) {
+    for _, p   := range a {
+        bv, in_b := ParamValue( b, p.Key)
+        if in_b && (bv == p.Value) { continue}
+        diffs   = append( diffs, ParamDiff{ Key: p.Key, A: p.Value, B: bv, In_a: true, In_b: in_b})
+    }
+    for _, p   := range b {
+        if _, in_a := ParamValue( a, p.Key); in_a { continue}
+        diffs   = append( diffs, ParamDiff{ Key: p.Key, B: p.Value, In_b: true})
+    }
+    return diffs
+}
+
+// for latlearn's internal use only
+//
+// The text report's params block, like:
+//     params:
+//       N:     100
+//       cores: 8
+func write_meta_to_report( w io.Writer, meta []Param) {
+    if (len( meta) == 0) { return}
+
+    longest    := 0
+    for _, p   := range meta {
+        if (len( p.Key) > longest) { longest = len( p.Key)}
+    }
+    io.WriteString( w, "params:\n")
+    for _, p   := range meta {
+        io.WriteString( w, fmt.Sprintf( "  %-*s %s\n", longest + 1, p.Key + ":", p.Value))
+    }
+    io.WriteString( w, "\n")
+}
+
+// for latlearn's internal use only
+//
+// The inverse of write_meta_to_report, for ParseReport. The block's lines,
+// after the "params:" one.
+func parse_meta_block( lines []string) (meta []Param) {
+    for _, line := range lines {
+        key, value, found := strings.Cut( line, ":")
+        if !found { continue}
+        meta = append( meta, Param{ Key: strings.TrimSpace( key), Value: strings.TrimSpace( value)})
+    }
+    return meta
+}
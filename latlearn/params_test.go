@@ -0,0 +1,51 @@
+package latlearn_test
+
+import (
+    "bytes"
+    "reflect"
+    "testing"
+
+    "."
+)
+
+func TestParams( t *testing.T) {
+    params := latlearn.ParamsOf( map[string]string { "cores": "8", "N": "100", "commit": "abc"})
+    if want := []latlearn.Param { { "N", "100"}, { "commit", "abc"}, { "cores", "8"}}; !reflect.DeepEqual( params, want) {
+        t.Errorf( "ParamsOf: want %v, got %v", want, params)
+    }
+    if v, found := latlearn.ParamValue( params, "cores"); !found || (v != "8") {
+        t.Errorf( "ParamValue: want 8, got %v, %s", found, v)
+    }
+    if _, found := latlearn.ParamValue( params, "nosuch"); found {
+        t.Errorf( "ParamValue of an unknown key: want not found")
+    }
+
+    other  := []latlearn.Param { { "cores", "16"}, { "commit", "abc"}, { "dataset", "small"}}
+    want   := []latlearn.ParamDiff {
+                  { Key: "N", A: "100", In_a: true},
+                  { Key: "cores", A: "8", B: "16", In_a: true, In_b: true},
+                  { Key: "dataset", B: "small", In_b: true}}
+    if diffs := latlearn.DiffParams( params, other); !reflect.DeepEqual( diffs, want) {
+        t.Errorf( "DiffParams: want %v, got %v", want, diffs)
+    }
+
+    // a text report keeps both kinds of params apart
+    rd     := &latlearn.ReportData{ Params: []string { "level: 3"}, Meta: params, Spans: []latlearn.SpanData { span_row( "fn", 100, 10)}}
+    var buf bytes.Buffer
+    latlearn.WriteReport( &buf, rd)
+    back, err := latlearn.ParseReport( &buf)
+    if (err != nil) || !reflect.DeepEqual( back.Meta, params) || !reflect.DeepEqual( back.Params, rd.Params) || (len( back.Spans) != 1) {
+        t.Errorf( "ParseReport of a report with params: got %v, %#v", err, back)
+    }
+
+    // a merge keeps the params all its inputs share, and each input's as a source's
+    a      := latlearn.StateOfReport( &latlearn.ReportData{ Meta: params}, "a")
+    b      := latlearn.StateOfReport( &latlearn.ReportData{ Meta: other},  "b")
+    merged := latlearn.Merge( a, b)
+    if !reflect.DeepEqual( merged.Meta, []latlearn.Param { { "commit", "abc"}}) || !reflect.DeepEqual( merged.Sources[ 1].Meta, other) {
+        t.Errorf( "Merge: want the shared params, got %v and sources %#v", merged.Meta, merged.Sources)
+    }
+    if rd := latlearn.ReportOfState( merged); !reflect.DeepEqual( rd.Meta, merged.Meta) {
+        t.Errorf( "ReportOfState: want the params, got %v", rd.Meta)
+    }
+}
@@ -0,0 +1,91 @@
+// pprof_labels.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "context"
+    "runtime/pprof"
+    "sync"
+)
+
+// If true, B/B2 label the calling goroutine with PPROF_LABEL_KEY set to the
+// span key, like "fn3(n=50)", until A/A2. So a CPU profile can be split by
+// span: go tool pprof -tagfocus=latlearn_span=fn3 cpu.prof. Goroutines
+// started within a span inherit its label, as pprof labels always are.
+//
+// A restores the labels the goroutine had at B: those of the span it was
+// nested in (so the outer span's label is back for the rest of it), or else
+// none. For that, each B notes its goroutine, at the cost of a runtime.Stack
+// call (about a µs), and so B and A must be called on the same goroutine. Any
+// span begun within it but never ended, like by an early return or a panic,
+// is dropped at A, so its label does not outlive the outer span. But one never
+// ended at the top of a goroutine stays open, as far as labels go, for the
+// rest of that goroutine (and, if it exits, is never freed.)
+// NOTE: Go has no way to read a goroutine's labels, only to set them. So for
+// a span within labels the app set by other means, like pprof.Do, begin it
+// with BCtx and that context: its labels are kept in the span's, and A
+// restores them.
+var Pprof_labels bool = false
+
+const PPROF_LABEL_KEY = "latlearn_span"
+
+// for latlearn's internal use only
+//
+// The spans open on each goroutine with pprof labels set, innermost last.
+var pprof_open_mu sync.Mutex
+var pprof_open    = map[int64][]*SpanSampleUnderway {}
+
+// for latlearn's internal use only
+//
+// Called before T1 is taken, after any trace task is made.
+func (ssu *SpanSampleUnderway) pprof_before() {
+    g               := ssu.goroutine_of_b()
+    pprof_open_mu.Lock()
+    var enclosing *SpanSampleUnderway
+    if open         := pprof_open[ g]; (len( open) > 0) { enclosing = open[ len( open) - 1]}
+    pprof_open[ g]   = append( pprof_open[ g], ssu)
+    pprof_open_mu.Unlock()
+
+    // the labels of the enclosing span, unless given others by BCtx
+    labels          := []string {}
+    if (ssu.ctx == nil) && (enclosing != nil) {
+        pprof.ForLabels( enclosing.span_ctx, func( key string, value string) bool {
+            if (key != PPROF_LABEL_KEY) { labels = append( labels, key, value)}
+            return true
+        })
+    }
+    labels           = append( labels, PPROF_LABEL_KEY, span_key_form( ssu.Name, ssu.Variant))
+    ssu.span_ctx     = pprof.WithLabels( ssu.Ctx(), pprof.Labels( labels...))
+    pprof.SetGoroutineLabels( ssu.span_ctx)
+    ssu.pprof_set    = true
+}
+
+// for latlearn's internal use only
+//
+// Called after T2 is taken. Drops this span from its goroutine's stack, with
+// any begun after it which were never ended. Then sets the labels of the BCtx
+// context, or else of the innermost span still open, or else none.
+func (ssu *SpanSampleUnderway) pprof_after() {
+    g               := ssu.goroutine
+    pprof_open_mu.Lock()
+    open            := pprof_open[ g]
+    for i           := len( open) - 1; (i >= 0); i-- { // usually the last
+        if (open[ i] == ssu) {
+            open     = open[ :i]
+            break
+        }
+    }
+    var restore context.Context = context.Background()
+    if (len( open) > 0) { restore = open[ len( open) - 1].span_ctx}
+    if (len( open) == 0) {
+        delete( pprof_open, g)
+    } else {
+        pprof_open[ g] = open
+    }
+    pprof_open_mu.Unlock()
+
+    if (ssu.ctx != nil) { restore = ssu.ctx}
+    pprof.SetGoroutineLabels( restore)
+    ssu.pprof_set    = false
+}
@@ -0,0 +1,93 @@
+// replay.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "regexp"
+    "strings"
+    "time"
+)
+
+// Which samples of a sample log Replay learns from.
+type ReplayOpts struct {
+    From  time.Duration // only samples which started at or after this, since the log's init
+    To    time.Duration // ... and before this. 0 means to the end of the log
+    Spans []string      // patterns, as for Budget. a sample is kept if its key or span name matches any. none keeps all
+}
+
+// Rebuilds a report from a sample log (see Sample_log_fpath) by feeding its
+// samples through the same learner and variant-parent logic as a live
+// process. Like to see only the 30 seconds after a lag spike. Spans are in
+// the order first sampled. Since_init, and so each Time_frac, is of the
+// replayed window. No overhead is subtracted. The Params say what was
+// replayed. A log cut short (like by a crash) is replayed up to the cut.
+func Replay( slr *SampleLogReader, opts ReplayOpts) (rd *ReportData, err error) {
+    pre        := "latlearn.Replay"
+
+    res        := []*regexp.Regexp {}
+    for _, pattern := range opts.Spans {
+        re, err := glob_regexp( pattern)
+        if (err != nil) { return nil, fmt.Errorf( "%s: bad span pattern '%s': %v", pre, pattern, err)}
+        res      = append( res, re)
+    }
+    keep       := func( s Sample) bool {
+        if (len( res) == 0) { return true}
+        for _, re := range res {
+            if re.MatchString( s.Key) || re.MatchString( s.Name) { return true}
+        }
+        return false
+    }
+
+    lrs        := map[string]latencyLearnerI {}
+    tracked    := []string {}
+    n          := 0
+    end        := opts.From // of the last kept sample, since init
+    cut_short  := false
+
+    for {
+        s, err := slr.Next()
+        if (err == io.EOF) { break}
+        if errors.Is( err, io.ErrUnexpectedEOF) { cut_short = true; break}
+        if (err != nil) { return nil, fmt.Errorf( "%s: %v", pre, err)}
+
+        t1     := s.T1.Sub( slr.Init_time)
+        if (t1 < opts.From) || ((opts.To > 0) && (t1 >= opts.To)) || !keep( s) { continue}
+
+        learn_sample( lrs, &tracked, s.Name, s.Variant, t1 + s.Dur, s.Dur)
+        n++
+        if (t1 + s.Dur > end) { end = t1 + s.Dur}
+    }
+
+    since      := end - opts.From
+    if (opts.To > 0) { since = opts.To - opts.From}
+    if (since < 1)   { since = 1}
+
+    to_txt     := "end"
+    if (opts.To > 0) { to_txt = opts.To.String()}
+    rd          = &ReportData{
+                      Format:     REPORT_FORMAT,
+                      Version:    REPORT_FORMAT_VERSION,
+                      Since_init: int64( since),
+                      Params:     []string {
+                          "replay of sample log",
+                          fmt.Sprintf( "from: %s", opts.From),
+                          fmt.Sprintf( "to: %s", to_txt),
+                          fmt.Sprintf( "samples: %d", n)},
+                      Spans:      []SpanData {}}
+    if (len( opts.Spans) > 0) { rd.Params = append( rd.Params, "spans: " + strings.Join( opts.Spans, " "))}
+    if cut_short              { rd.Params = append( rd.Params, "log cut short")}
+
+    for _, key := range tracked {
+        lli     := lrs[ key]
+        sd      := lli.getLL().span_data( since, since, 0) // an overhead of 0 subtracts nothing
+        if vll  := lli.getVLL(); (vll != nil) && (vll.parent != nil) {
+            sd.Parent = vll.parent.Name
+        }
+        rd.Spans = append( rd.Spans, sd)
+    }
+    return rd, nil
+}
@@ -0,0 +1,90 @@
+package latlearn_test
+
+import (
+    "bytes"
+    "encoding/binary"
+    "strings"
+    "testing"
+    "time"
+
+    "."
+)
+
+// a sample log, as the serve goroutine would write it, of samples given as
+// {key id, t1, dur}, with keys 0 "draw", 1 "collide(n=3)" and 2 "collide(n=9)"
+func sample_log_bytes( samples [][3]int64) []byte {
+    b    := append( []byte( latlearn.SAMPLE_LOG_MAGIC), latlearn.SAMPLE_LOG_VERSION)
+    b     = binary.AppendVarint( b, time.Date( 2026, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+    keys := [][2]string { { "draw", ""}, { "collide", "n=3"}, { "collide", "n=9"}}
+    for id, k := range keys {
+        b = append( b, 'K')
+        b = binary.AppendUvarint( b, uint64( id))
+        b = binary.AppendUvarint( b, uint64( len( k[0])))
+        b = append( b, k[0]...)
+        b = binary.AppendUvarint( b, uint64( len( k[1])))
+        b = append( b, k[1]...)
+    }
+    for i, s := range samples {
+        b = append( b, 'S')
+        b = binary.AppendUvarint( b, uint64( s[0]))
+        b = binary.AppendVarint(  b, s[1])
+        b = binary.AppendVarint(  b, s[2])
+        b = binary.AppendUvarint( b, uint64( i + 1))
+    }
+    return b
+}
+
+func TestReplay( t *testing.T) {
+    sec  := int64( time.Second)
+    data := sample_log_bytes( [][3]int64 {
+                { 0,  1 * sec, 100}, { 1,  2 * sec, 300}, { 0, 10 * sec, 900},
+                { 2, 11 * sec, 500}, { 1, 12 * sec, 700}, { 0, 40 * sec, 200}})
+
+    replay := func( opts latlearn.ReplayOpts) *latlearn.ReportData {
+        slr, err := latlearn.ReadSampleLog( bytes.NewReader( data))
+        if (err != nil) { t.Fatalf( "ReadSampleLog: %v", err)}
+        rd, err  := latlearn.Replay( slr, opts)
+        if (err != nil) { t.Fatalf( "Replay: %v", err)}
+        return rd
+    }
+    rows   := func( rd *latlearn.ReportData) string {
+        txt := []string {}
+        for _, sd := range rd.Spans {
+            txt = append( txt, sd.Name + "/" + sd.Parent + "=" + time.Duration( sd.Mean).String())
+        }
+        return strings.Join( txt, " ")
+    }
+
+    if got  := rows( replay( latlearn.ReplayOpts{})); (got != "draw/=400ns collide/=500ns collide(n=3)/collide=500ns collide(n=9)/collide=500ns") {
+        t.Errorf( "Replay all: got %s", got)
+    }
+
+    // only the 30 seconds after the spike at 10s, and only collide(*)
+    rd     := replay( latlearn.ReplayOpts{ From: 10 * time.Second, To: 40 * time.Second, Spans: []string { "collide(*)"}})
+    if got := rows( rd); (got != "collide/=600ns collide(n=9)/collide=500ns collide(n=3)/collide=700ns") {
+        t.Errorf( "Replay window: got %s", got)
+    }
+    if (rd.Since_init != 30 * sec) || (rd.Spans[ 0].Weight != 2) || (rd.Spans[ 0].Time_frac != 1200.0 / float64( 30 * sec)) {
+        t.Errorf( "Replay window: got since_init %d, %#v", rd.Since_init, rd.Spans[ 0])
+    }
+
+    // the text report it makes can be read back
+    var buf bytes.Buffer
+    if err := latlearn.WriteReport( &buf, rd); (err != nil) {
+        t.Fatalf( "WriteReport: %v", err)
+    }
+    back, err := latlearn.ParseReport( &buf)
+    if (err != nil) || (rows( back) != rows( rd)) || (len( back.Params) != len( rd.Params)) {
+        t.Errorf( "WriteReport then ParseReport: got err %v, %s, params %v", err, rows( back), back.Params)
+    }
+
+    if got := rows( replay( latlearn.ReplayOpts{ Spans: []string { "draw"}})); (got != "draw/=400ns") {
+        t.Errorf( "Replay draw: got %s", got)
+    }
+
+    // a log cut short replays up to the cut
+    data    = data[:len( data) - 2]
+    if rd  := replay( latlearn.ReplayOpts{}); (rd.Spans[ 0].Weight != 2) || !strings.Contains( strings.Join( rd.Params, ","), "cut short") {
+        t.Errorf( "Replay of a cut log: got %#v, params %v", rd.Spans[ 0], rd.Params)
+    }
+}
@@ -0,0 +1,234 @@
+// report_compare.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "fmt"
+    "io"
+    "math"
+    "sort"
+)
+
+// How to compare a baseline report against a candidate, with Compare.
+type CompareOpts struct {
+    Confidence float64 // like 0.95 (the default, if 0.) a change is significant if p < 1 - Confidence
+    Test       string  // "auto" (the default, if ""), "mann-whitney" or "welch"
+}
+
+// One span, aligned by name across a baseline (a) and a candidate (b)
+// report, and whether its latency changed by more than noise would explain.
+// Status is as for SpanDiff. Test is the one used: "mann-whitney" (which
+// compares the medians, from the histograms) or "welch" (the means, from the
+// variances.) If neither could be used, like for a text report, Test is ""
+// and P is -1. Center_a and Center_b are the medians or the means, in ns.
+type SpanCompare struct {
+    Name        string  `json:"name"`
+    Status      string  `json:"status"`
+    Test        string  `json:"test"`
+    N_a         int     `json:"n_a"`
+    N_b         int     `json:"n_b"`
+    Center_a    float64 `json:"center_a"`
+    Center_b    float64 `json:"center_b"`
+    Delta       Delta   `json:"delta"`
+    P           float64 `json:"p"`
+    Significant bool    `json:"significant"`
+}
+
+// Compares each span of a candidate report b against a baseline report a,
+// like benchstat does for Go benchmarks. Where both sides have histograms
+// (a JSON report from this version on) it uses a Mann-Whitney U test, which
+// a single GC pause cannot sway much. Else, where both have a variance, a
+// Welch t-test. The result is in the same order as from Diff.
+func Compare( a *ReportData, b *ReportData, opts CompareOpts) (cmps []SpanCompare, err error) {
+    pre        := "latlearn.Compare"
+
+    if (opts.Confidence == 0) { opts.Confidence = 0.95}
+    if (opts.Confidence <= 0) || (opts.Confidence >= 1) {
+        return nil, fmt.Errorf( "%s: confidence must be in (0, 1), got %f", pre, opts.Confidence)
+    }
+    if (opts.Test == "") { opts.Test = "auto"}
+    switch opts.Test {
+        case "auto", "mann-whitney", "welch":
+        default: return nil, fmt.Errorf( "%s: unknown test '%s'", pre, opts.Test)
+    }
+    alpha      := 1 - opts.Confidence
+
+    for _, d   := range Diff( a, b) {
+        c      := SpanCompare{ Name: d.Name, Status: d.Status, P: -1}
+        if (d.Status != "changed") {
+            cmps = append( cmps, c)
+            continue
+        }
+        c.N_a, c.N_b = d.A.Weight, d.B.Weight
+
+        has_hist := (len( d.A.Hist) > 0) && (len( d.B.Hist) > 0)
+        has_var  := (d.A.Weight > 1) && (d.B.Weight > 1) && ((d.A.Variance > 0) || (d.B.Variance > 0)) // else unknown, like from a text report
+
+        switch {
+            case (opts.Test != "welch") && has_hist:
+                c.Test        = "mann-whitney"
+                c.P           = mann_whitney_p( d.A.Hist, d.B.Hist)
+                med_a, _     := d.A.Quantile( 0.5)
+                med_b, _     := d.B.Quantile( 0.5)
+                c.Center_a    = float64( med_a)
+                c.Center_b    = float64( med_b)
+            case (opts.Test != "mann-whitney") && has_var:
+                c.Test        = "welch"
+                c.P           = welch_p( d.A, d.B)
+                c.Center_a    = float64( d.A.Mean)
+                c.Center_b    = float64( d.B.Mean)
+            default:
+                c.Center_a    = float64( d.A.Mean)
+                c.Center_b    = float64( d.B.Mean)
+        }
+        c.Delta        = delta( c.Center_a, c.Center_b)
+        c.Significant  = (c.P >= 0) && (c.P < alpha)
+        cmps           = append( cmps, c)
+    }
+    return cmps, nil
+}
+
+// for latlearn's internal use only
+//
+// The two-sided p-value of a Mann-Whitney U test, by its normal approximation
+// (with a tie correction and a continuity correction.) The samples in one
+// histogram bucket are taken as tied, which only makes it more conservative.
+// Both histograms share the same bucket bounds, so are aligned by Lo.
+func mann_whitney_p( ha []HistBucket, hb []HistBucket) (p float64) {
+    type pair struct { lo int64; a, b float64 }
+    by_lo      := map[int64]*pair {}
+    for _, hbk := range ha {
+        if (by_lo[ hbk.Lo] == nil) { by_lo[ hbk.Lo] = &pair{ lo: hbk.Lo}}
+        by_lo[ hbk.Lo].a += float64( hbk.Count)
+    }
+    for _, hbk := range hb {
+        if (by_lo[ hbk.Lo] == nil) { by_lo[ hbk.Lo] = &pair{ lo: hbk.Lo}}
+        by_lo[ hbk.Lo].b += float64( hbk.Count)
+    }
+    pairs      := []*pair {}
+    for _, pr  := range by_lo {
+        pairs   = append( pairs, pr)
+    }
+    sort.Slice( pairs, func( i, j int) bool { return pairs[ i].lo < pairs[ j].lo})
+
+    n1, n2     := 0.0, 0.0
+    for _, pr  := range pairs {
+        n1     += pr.a
+        n2     += pr.b
+    }
+    n          := n1 + n2
+    if (n1 == 0) || (n2 == 0) { return -1}
+
+    // U counts, over every (a, b) pair of samples, how often a's is the greater, ties as half
+    u          := 0.0
+    b_below    := 0.0
+    ties       := 0.0 // sum of t^3 - t, over the groups of tied samples
+    for _, pr  := range pairs {
+        u       += pr.a * (b_below + (pr.b / 2))
+        b_below += pr.b
+        t       := pr.a + pr.b
+        ties    += (t * t * t) - t
+    }
+
+    mean       := n1 * n2 / 2
+    sigma_sq   := (n1 * n2 / 12) * ((n + 1) - (ties / (n * (n - 1))))
+    if (sigma_sq <= 0) { return 1} // every sample tied: no evidence of a change
+
+    z          := math.Max( math.Abs( u - mean) - 0.5, 0) / math.Sqrt( sigma_sq)
+    return math.Erfc( z / math.Sqrt2)
+}
+
+// for latlearn's internal use only
+//
+// The two-sided p-value of Welch's t-test, of whether the means differ.
+func welch_p( sa SpanData, sb SpanData) (p float64) {
+    na, nb     := float64( sa.Weight), float64( sb.Weight)
+    va, vb     := sa.Variance / na, sb.Variance / nb
+    t          := (float64( sb.Mean) - float64( sa.Mean)) / math.Sqrt( va + vb)
+    df         := ((va + vb) * (va + vb)) / (((va * va) / (na - 1)) + ((vb * vb) / (nb - 1)))
+    return incomplete_beta( df / 2, 0.5, df / (df + (t * t)))
+}
+
+// for latlearn's internal use only
+//
+// The regularized incomplete beta function I_x(a, b), by its continued
+// fraction (as in Numerical Recipes.)
+func incomplete_beta( a float64, b float64, x float64) float64 {
+    if (x <= 0) { return 0}
+    if (x >= 1) { return 1}
+
+    lga, _     := math.Lgamma( a)
+    lgb, _     := math.Lgamma( b)
+    lgab, _    := math.Lgamma( a + b)
+    front      := math.Exp( lgab - lga - lgb + (a * math.Log( x)) + (b * math.Log( 1 - x)))
+
+    // the fraction converges quickly only for x below this, else use the symmetry
+    if (x > (a + 1) / (a + b + 2)) {
+        return 1 - (front * beta_cont_frac( b, a, 1 - x) / b)
+    }
+    return front * beta_cont_frac( a, b, x) / a
+}
+
+// for latlearn's internal use only
+func beta_cont_frac( a float64, b float64, x float64) float64 {
+    const tiny  = 1e-300
+    c, d       := 1.0, 1 - ((a + b) * x / (a + 1))
+    if (math.Abs( d) < tiny) { d = tiny}
+    d           = 1 / d
+    h          := d
+
+    for m := 1; m <= 300; m++ {
+        fm     := float64( m)
+        for i  := 0; i < 2; i++ {
+            num := 0.0
+            if (i == 0) {
+                num = fm * (b - fm) * x / ((a + (2 * fm) - 1) * (a + (2 * fm)))
+            } else {
+                num = -(a + fm) * (a + b + fm) * x / ((a + (2 * fm)) * (a + (2 * fm) + 1))
+            }
+            d    = 1 + (num * d)
+            if (math.Abs( d) < tiny) { d = tiny}
+            c    = 1 + (num / c)
+            if (math.Abs( c) < tiny) { c = tiny}
+            d    = 1 / d
+            h   *= d * c
+            if (i == 1) && (math.Abs( (d * c) - 1) < 1e-12) { return h}
+        }
+    }
+    return h
+}
+
+// Writes compares as a plain text table, one row per span. Like benchstat,
+// a change which is not significant shows "~" rather than a percent.
+func WriteCompare( w io.Writer, cmps []SpanCompare) (err error) {
+    longest_name := len( "span")
+    for _, c     := range cmps {
+        if (len( c.Name) > longest_name) { longest_name = len( c.Name)}
+    }
+
+    name_field   := fmt.Sprintf( "%%-%ds", longest_name)
+    format       := name_field + " | %-9s | %-12s | %13s | %13s | %15s | %15s | %8s | %8s\n"
+
+    _, err        = fmt.Fprintf( w, format,
+                        "span", "status", "test", "n a", "n b", "a (ns)", "b (ns)", "delta", "p")
+    if (err != nil) { return err}
+
+    for _, c     := range cmps {
+        n_a, n_b, a, b, pct, p := "", "", "", "", "", ""
+        if (c.Status == "changed") {
+            n_a, n_b = number_grouped( int64( c.N_a), ","), number_grouped( int64( c.N_b), ",")
+            a, b     = number_grouped( int64( c.Center_a), ","), number_grouped( int64( c.Center_b), ",")
+            pct, p   = "?", "?" // untested
+            if (c.P >= 0) {
+                pct  = "~"
+                if c.Significant && c.Delta.Pct_valid { pct = fmt.Sprintf( "%+.1f%%", c.Delta.Pct)}
+                p    = fmt.Sprintf( "%.3f", c.P)
+            }
+        }
+
+        _, err    = fmt.Fprintf( w, format, c.Name, c.Status, c.Test, n_a, n_b, a, b, pct, p)
+        if (err != nil) { return err}
+    }
+    return nil
+}
@@ -0,0 +1,67 @@
+package latlearn_test
+
+import (
+    "bytes"
+    "math"
+    "strings"
+    "testing"
+
+    "."
+)
+
+func TestCompare( t *testing.T) {
+    // same means and variances as a textbook Welch example: t = 2.236, df = 18, p = 0.0382
+    welch_a  := span_row( "welch", 100, 10)
+    welch_b  := span_row( "welch", 110, 10)
+    welch_a.Variance, welch_b.Variance = 100, 100
+
+    // the candidate has far more of its samples in the slower bucket
+    hist_a   := []latlearn.HistBucket { { Lo: 1000, Hi: 1001, Count: 50}, { Lo: 1100, Hi: 1101, Count: 50}}
+    hist_b   := []latlearn.HistBucket { { Lo: 1000, Hi: 1001, Count: 20}, { Lo: 1100, Hi: 1101, Count: 80}}
+    mw_a     := latlearn.SpanData{ Name: "mw",   Completed: true, Min: 1000, Max: 1100, Mean: 1050, Weight: 100, Hist: hist_a}
+    mw_b     := latlearn.SpanData{ Name: "mw",   Completed: true, Min: 1000, Max: 1100, Mean: 1080, Weight: 100, Hist: hist_b}
+    same_a   := latlearn.SpanData{ Name: "same", Completed: true, Min: 1000, Max: 1100, Mean: 1050, Weight: 100, Hist: hist_a}
+
+    a        := &latlearn.ReportData{ Spans: []latlearn.SpanData { welch_a, mw_a, same_a, span_row( "text-only", 100, 1)}}
+    b        := &latlearn.ReportData{ Spans: []latlearn.SpanData { welch_b, mw_b, same_a, span_row( "text-only", 900, 1)}}
+
+    cmps, err := latlearn.Compare( a, b, latlearn.CompareOpts{})
+    if (err != nil) || (len( cmps) != 4) {
+        t.Fatalf( "Compare: want 4 rows, got %d, err %v", len( cmps), err)
+    }
+
+    if c := cmps[0]; (c.Test != "welch") || (math.Abs( c.P - 0.0382) > 0.0005) || !c.Significant {
+        t.Errorf( "Compare welch: want p ~0.0382 & significant, got %#v", c)
+    }
+    if c := cmps[1]; (c.Test != "mann-whitney") || (c.P > 0.0001) || !c.Significant || (c.Center_a != 1000) || (c.Center_b != 1100) {
+        t.Errorf( "Compare mann-whitney: want tiny p, significant, medians 1000 & 1100, got %#v", c)
+    }
+    if c := cmps[2]; (c.Test != "mann-whitney") || c.Significant {
+        t.Errorf( "Compare same: want not significant, got %#v", c)
+    }
+    if c := cmps[3]; (c.Test != "") || (c.P != -1) || c.Significant {
+        t.Errorf( "Compare text-only: want no test, got %#v", c)
+    }
+
+    // a stricter confidence makes the welch change noise
+    cmps, _   = latlearn.Compare( a, b, latlearn.CompareOpts{ Confidence: 0.99})
+    if cmps[0].Significant {
+        t.Errorf( "Compare at 0.99: want welch not significant, got %#v", cmps[0])
+    }
+    cmps, _   = latlearn.Compare( a, b, latlearn.CompareOpts{ Test: "welch"})
+    if (cmps[1].Test != "") {
+        t.Errorf( "Compare forced welch: want no test for mw (no variance), got %s", cmps[1].Test)
+    }
+
+    for _, opts := range []latlearn.CompareOpts { { Confidence: 1.5}, { Test: "bogus"}} {
+        if _, err := latlearn.Compare( a, b, opts); (err == nil) {
+            t.Errorf( "Compare %#v: want an error", opts)
+        }
+    }
+
+    cmps, _   = latlearn.Compare( a, b, latlearn.CompareOpts{})
+    var buf bytes.Buffer
+    if err := latlearn.WriteCompare( &buf, cmps); (err != nil) || !strings.Contains( buf.String(), "+10.0%") || !strings.Contains( buf.String(), "~") {
+        t.Errorf( "WriteCompare: got err %v, text:\n%s", err, buf.String())
+    }
+}
@@ -0,0 +1,172 @@
+// report_diff.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "fmt"
+    "io"
+    "math"
+    "sort"
+)
+
+// How one metric of a span changed, from report a (before) to b (after).
+// Pct is relative to A, and so is only valid when A is non-zero.
+type Delta struct {
+    A         float64 `json:"a"`
+    B         float64 `json:"b"`
+    Abs       float64 `json:"abs"` // B - A
+    Pct       float64 `json:"pct"` // 100 * (B - A) / A
+    Pct_valid bool    `json:"pct_valid"`
+}
+
+// One span, aligned by name across two reports. Status is one of:
+//     "changed"   in both, and completed in both (the deltas are set)
+//     "new"       completed only in b
+//     "vanished"  completed only in a
+//     "unsampled" in neither, completed
+type SpanDiff struct {
+    Name      string   `json:"name"`
+    Status    string   `json:"status"`
+    A         SpanData `json:"a"`
+    B         SpanData `json:"b"`
+    Min       Delta    `json:"min"`
+    Mean      Delta    `json:"mean"`
+    Max       Delta    `json:"max"`
+    Weight    Delta    `json:"weight"`
+    Time_frac Delta    `json:"time_frac"`
+}
+
+// for latlearn's internal use only
+func delta( a float64, b float64) (d Delta) {
+    d.A, d.B, d.Abs = a, b, (b - a)
+    if (a != 0) {
+        d.Pct       = 100 * (b - a) / a
+        d.Pct_valid = true
+    }
+    return d
+}
+
+// Aligns the spans of report a (before) and report b (after) by name, and
+// works out how each one's min, mean, max, weight and time fraction moved.
+// The result is in a's span order, followed by any spans found only in b.
+func Diff( a *ReportData, b *ReportData) (diffs []SpanDiff) {
+    b_by_name    := map[string]SpanData {}
+    for _, sd    := range b.Spans {
+        b_by_name[ sd.Name] = sd
+    }
+    a_names      := map[string]bool {}
+
+    add          := func( name string, sa SpanData, sb SpanData) {
+        d        := SpanDiff{ Name: name, A: sa, B: sb}
+        switch {
+            case sa.Completed && sb.Completed:
+                d.Status    = "changed"
+                d.Min       = delta( float64( sa.Min),    float64( sb.Min))
+                d.Mean      = delta( float64( sa.Mean),   float64( sb.Mean))
+                d.Max       = delta( float64( sa.Max),    float64( sb.Max))
+                d.Weight    = delta( float64( sa.Weight), float64( sb.Weight))
+                d.Time_frac = delta( sa.Time_frac,        sb.Time_frac)
+            case sb.Completed: d.Status = "new"
+            case sa.Completed: d.Status = "vanished"
+            default:           d.Status = "unsampled"
+        }
+        diffs     = append( diffs, d)
+    }
+
+    for _, sa    := range a.Spans {
+        a_names[ sa.Name] = true
+        sb, found := b_by_name[ sa.Name]
+        if !found { sb = SpanData{ Name: sa.Name}} // so not Completed
+        add( sa.Name, sa, sb)
+    }
+    for _, sb    := range b.Spans {
+        if a_names[ sb.Name] { continue}
+        add( sb.Name, SpanData{ Name: sb.Name}, sb)
+    }
+    return diffs
+}
+
+// for latlearn's internal use only
+func diff_metric( d *SpanDiff, metric string) (dm *Delta, ok bool) {
+    switch metric {
+        case "min":       return &d.Min,       true
+        case "mean":      return &d.Mean,      true
+        case "max":       return &d.Max,       true
+        case "weight":    return &d.Weight,    true
+        case "time_frac": return &d.Time_frac, true
+    }
+    return nil, false
+}
+
+// Sorts diffs in place so the worst regressions come first: by the largest
+// percent increase of the given metric ("min", "mean", "max", "weight" or
+// "time_frac".) Spans whose percent change is unknown (like new or vanished
+// ones) go last, in their prior order.
+func SortDiffsByRegression( diffs []SpanDiff, metric string) (err error) {
+    if _, ok := diff_metric( &SpanDiff{}, metric); !ok {
+        return fmt.Errorf( "latlearn.SortDiffsByRegression: unknown metric '%s'", metric)
+    }
+
+    key      := func( i int) float64 {
+        dm, _ := diff_metric( &diffs[ i], metric)
+        if (diffs[ i].Status != "changed") || !dm.Pct_valid { return math.Inf( -1)}
+        return dm.Pct
+    }
+    sort.SliceStable( diffs, func( i, j int) bool { return key( i) > key( j)})
+    return nil
+}
+
+// for latlearn's internal use only
+func delta_txt( d Delta, is_frac bool) (abs_txt string, pct_txt string) {
+    if is_frac {
+        abs_txt = fmt.Sprintf( "%+.6f", d.Abs)
+    } else {
+        sign   := "+"
+        if (d.Abs < 0) { sign = "-"}
+        abs_txt = sign + number_grouped( int64( math.Abs( d.Abs)), ",")
+    }
+    pct_txt     = "n/a"
+    if d.Pct_valid { pct_txt = fmt.Sprintf( "%+.1f%%", d.Pct)}
+    return abs_txt, pct_txt
+}
+
+// Writes diffs as a plain text table, one row per span, in the same spirit
+// as the text report. Deltas are shown as absolute and percent changes.
+func WriteDiff( w io.Writer, diffs []SpanDiff) (err error) {
+    longest_name := len( "span")
+    for _, d     := range diffs {
+        if (len( d.Name) > longest_name) { longest_name = len( d.Name)}
+    }
+
+    name_field   := fmt.Sprintf( "%%-%ds", longest_name)
+    format       := name_field + " | %-9s | %15s | %15s | %15s %8s | %15s %8s | %15s %8s | %13s %8s | %9s %8s\n"
+
+    _, err        = fmt.Fprintf( w, format,
+                        "span", "status", "mean a (ns)", "mean b (ns)",
+                        "mean delta", "%", "min delta", "%", "max delta", "%",
+                        "weight delta", "%", "tf delta", "%")
+    if (err != nil) { return err}
+
+    for _, d     := range diffs {
+        mean_a, mean_b := "", ""
+        if d.A.Completed { mean_a = number_grouped( d.A.Mean, ",")}
+        if d.B.Completed { mean_b = number_grouped( d.B.Mean, ",")}
+
+        cols     := []string {}
+        for i, dm := range []Delta { d.Mean, d.Min, d.Max, d.Weight, d.Time_frac} {
+            abs_txt, pct_txt := "", ""
+            if (d.Status == "changed") {
+                abs_txt, pct_txt = delta_txt( dm, (i == 4)) // the last is the time frac
+            }
+            cols  = append( cols, abs_txt, pct_txt)
+        }
+
+        _, err    = fmt.Fprintf( w, format,
+                        d.Name, d.Status, mean_a, mean_b,
+                        cols[0], cols[1], cols[2], cols[3], cols[4], cols[5],
+                        cols[6], cols[7], cols[8], cols[9])
+        if (err != nil) { return err}
+    }
+    return nil
+}
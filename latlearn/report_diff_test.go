@@ -0,0 +1,59 @@
+package latlearn_test
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+
+    "."
+)
+
+func span_row( name string, mean int64, weight int) latlearn.SpanData {
+    return latlearn.SpanData{
+               Name: name, Completed: true, Min: mean / 2, Last: mean, Max: mean * 2,
+               Mean: mean, Cumul: mean * int64( weight), Weight: weight, Time_frac: 0.1}
+}
+
+func TestDiff( t *testing.T) {
+    a     := &latlearn.ReportData{ Spans: []latlearn.SpanData {
+                 span_row( "is-mv-bl", 400, 10),
+                 span_row( "steady",   100, 10),
+                 span_row( "gone",     100, 10),
+                 { Name: "never", Min: -1, Last: -1, Max: -1, Mean: -1, Cumul: -1, Weight: -1}}}
+    b     := &latlearn.ReportData{ Spans: []latlearn.SpanData {
+                 span_row( "steady",   110, 10),
+                 span_row( "is-mv-bl", 200, 20),
+                 span_row( "fresh",     50, 10)}}
+
+    diffs := latlearn.Diff( a, b)
+
+    want  := map[string]string { "is-mv-bl": "changed", "steady": "changed", "gone": "vanished", "never": "unsampled", "fresh": "new"}
+    if (len( diffs) != len( want)) {
+        t.Fatalf( "Diff: want %d rows, got %d", len( want), len( diffs))
+    }
+    for _, d := range diffs {
+        if (d.Status != want[ d.Name]) {
+            t.Errorf( "Diff %s: want status %s, got %s", d.Name, want[ d.Name], d.Status)
+        }
+    }
+
+    d     := diffs[0]
+    if (d.Name != "is-mv-bl") || (d.Mean.Abs != -200) || (d.Mean.Pct != -50) || (d.Weight.Pct != 100) {
+        t.Errorf( "Diff is-mv-bl: got %#v", d)
+    }
+
+    if err := latlearn.SortDiffsByRegression( diffs, "mean"); (err != nil) {
+        t.Fatalf( "SortDiffsByRegression: %v", err)
+    }
+    if (diffs[0].Name != "steady") || (diffs[1].Name != "is-mv-bl") {
+        t.Errorf( "SortDiffsByRegression: want steady then is-mv-bl first, got %s then %s", diffs[0].Name, diffs[1].Name)
+    }
+    if err := latlearn.SortDiffsByRegression( diffs, "bogus"); (err == nil) {
+        t.Errorf( "SortDiffsByRegression of unknown metric: want an error")
+    }
+
+    var buf bytes.Buffer
+    if err := latlearn.WriteDiff( &buf, diffs); (err != nil) || !strings.Contains( buf.String(), "+10.0%") {
+        t.Errorf( "WriteDiff: got err %v, text:\n%s", err, buf.String())
+    }
+}
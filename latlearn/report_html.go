@@ -0,0 +1,315 @@
+// report_html.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "fmt"
+    "html/template"
+    "io"
+    "log"
+    "math"
+    "os"
+    "strings"
+)
+
+// A report as one static HTML file, for sharing with people who would rather
+// not read the text one. Everything (CSS, JS, charts) is inline: it makes no
+// network requests. Spans are grouped into variant families, which collapse,
+// and every column sorts. Each span gets its percentiles and a histogram (if
+// rd has them, as a live or JSON report does), a time fraction bar, and a
+// mean over time chart (if series were kept.)
+
+// for latlearn's internal use only
+type html_row struct {
+    Name, Parent                     string
+    Is_family                        bool // a parent, with variants under it
+    Completed                        bool
+    Min, Last, Max, Mean, Weight     int64
+    P50, P90, P99                    int64 // -1 if unknown
+    Tf                               float64
+    Tf_pct                           string
+    Hist_svg, Series_svg             template.HTML
+}
+
+// for latlearn's internal use only
+type html_family struct {
+    Rows []html_row // the parent (or a lone span) first, then any variants
+}
+
+// for latlearn's internal use only
+type html_view struct {
+    Title    string
+    Fields   []ReportField
+    Params   []string
+    Meta     []Param
+    Families []html_family
+}
+
+// for latlearn's internal use only
+//
+// The header of rd as key/value pairs, under the same keys as the text
+// report. As parsed, if rd came from ParseReport.
+func report_fields( rd *ReportData) (fields []ReportField) {
+    if (len( rd.Header) > 0) { return rd.Header}
+
+    add  := func( key string, format string, value any) {
+        fields = append( fields, ReportField{ Key: key, Value: fmt.Sprintf( format, value)})
+    }
+    num  := func( n int64) string { if (n <= 0) { return "?"}; return number_grouped( n, ",")}
+    str  := func( s string) string { if (s == "") { return "?"}; return s}
+
+    add( "Outer_queue_capacity",      "%d", rd.Outer_queue_capacity)
+    add( "Inner_queue_capacity",      "%d", rd.Inner_queue_capacity)
+    add( "Overhead_samples_started",  "%v", rd.Overhead_samples_started)
+    add( "Overhead_samples_finished", "%v", rd.Overhead_samples_finished)
+    add( "Overhead_samples_aborted",  "%v", rd.Overhead_samples_aborted)
+    add( "Benchmarks_started",        "%v", rd.Benchmarks_started)
+    add( "Benchmarks_finished",       "%v", rd.Benchmarks_finished)
+    add( "Benchmarks_aborted",        "%v", rd.Benchmarks_aborted)
+    add( "Should_report_builtins",    "%v", rd.Should_report_builtins)
+    add( "Should_subtract_overhead",  "%v", rd.Should_subtract_overhead)
+    if (rd.Report_opts != "") { add( "Report_opts", "%s", rd.Report_opts)}
+    add( "since LL init",             "%s ns", number_grouped( rd.Since_init, ","))
+    add( "Go ver",                    "%s", rd.Go_version)
+    add( "GOARCH",                    "%s", rd.GOARCH)
+    add( "GOOS",                      "%s", rd.GOOS)
+    add( "NumCPU",                    "%d", rd.NumCPU)
+    add( "GOMAXPROCS",                "%d", rd.GOMAXPROCS)
+    add( "NumGoroutine",              "%d", rd.NumGoroutine)
+    add( "SetMemoryLimit",            "%s bytes", number_grouped( rd.Mem_limit, ","))
+    add( "GOGC",                      "%s", rd.GOGC)
+    fields = append( fields, runtime_metrics_fields( rd.Runtime)...)
+    add( "host.os",                   "%s", str( rd.Host.OS))
+    add( "host.os_release",           "%s", str( rd.Host.OS_release))
+    add( "host.kernel",               "%s", str( rd.Host.Kernel))
+    add( "host.cpu_model",            "%s", str( rd.Host.Cpu_model))
+    add( "host.cpu_cores",            "%s", num( int64( rd.Host.Cpu_cores)))
+    add( "host.cpu_threads",          "%s", num( int64( rd.Host.Cpu_threads)))
+    add( "host.cpu_freq",             "%s hz", num( rd.Host.Cpu_freq_hz))
+    add( "host.cpu_freq_max",         "%s hz", num( rd.Host.Cpu_freq_max_hz))
+    add( "host.cpu_governor",         "%s", str( rd.Host.Cpu_governor))
+    add( "host.mem",                  "%s bytes", num( rd.Host.Mem_bytes))
+    add( "host.page",                 "%s bytes", num( rd.Host.Page_bytes))
+    cgcpu := "?"
+    if (rd.Host.Cgroup_cpu_limit > 0) { cgcpu = fmt.Sprintf( "%g", rd.Host.Cgroup_cpu_limit)}
+    add( "host.cgroup_cpu_limit",     "%s cpus", cgcpu)
+    add( "host.cgroup_mem_limit",     "%s bytes", num( rd.Host.Cgroup_mem_limit_bytes))
+    fields = append( fields, build_info_fields( rd.Build)...)
+    return fields
+}
+
+// for latlearn's internal use only
+//
+// Bars of the bucket counts, on a log scale of latency.
+func hist_svg( hbs []HistBucket) template.HTML {
+    if (len( hbs) == 0) { return ""}
+
+    const w, h   = 160.0, 28.0
+    lo          := math.Log( float64( hbs[ 0].Lo) + 1)
+    hi          := math.Log( float64( hbs[ len( hbs) - 1].Hi) + 1)
+    if (hi      <= lo) { hi = lo + 1}
+    most        := int64( 1)
+    for _, hb   := range hbs {
+        if (hb.Count > most) { most = hb.Count}
+    }
+
+    var sb strings.Builder
+    fmt.Fprintf( &sb, `<svg class="hist" width="%g" height="%g" viewBox="0 0 %g %g">`, w, h, w, h)
+    for _, hb   := range hbs {
+        x0      := (math.Log( float64( hb.Lo) + 1) - lo) / (hi - lo) * w
+        x1      := (math.Log( float64( hb.Hi) + 1) - lo) / (hi - lo) * w
+        bh      := math.Max( 1, float64( hb.Count) / float64( most) * h)
+        fmt.Fprintf( &sb, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f"><title>%s to %s ns: %s</title></rect>`,
+            x0, h - bh, math.Max( 1, x1 - x0), bh,
+            number_grouped( hb.Lo, ","), number_grouped( hb.Hi, ","), number_grouped( hb.Count, ","))
+    }
+    sb.WriteString( `</svg>`)
+    return template.HTML( sb.String())
+}
+
+// for latlearn's internal use only
+//
+// Bars of the mean latency of each interval, oldest at the left.
+func series_svg( sbs []SeriesBucket) template.HTML {
+    if (len( sbs) == 0) { return ""}
+
+    const w, h   = 160.0, 28.0
+    most        := 1.0
+    for _, b    := range sbs {
+        if (b.Count > 0) && (float64( b.Sum) / float64( b.Count) > most) { most = float64( b.Sum) / float64( b.Count)}
+    }
+    bw          := w / float64( len( sbs))
+
+    var sb strings.Builder
+    fmt.Fprintf( &sb, `<svg class="series" width="%g" height="%g" viewBox="0 0 %g %g">`, w, h, w, h)
+    for i, b    := range sbs {
+        if (b.Count == 0) { continue}
+        mean    := float64( b.Sum) / float64( b.Count)
+        bh      := math.Max( 1, mean / most * h)
+        fmt.Fprintf( &sb, `<rect x="%.2f" y="%.1f" width="%.2f" height="%.1f"><title>%s: mean %s ns, n %d</title></rect>`,
+            float64( i) * bw, h - bh, math.Max( 0.5, bw), bh, b.Start, number_grouped( int64( mean), ","), b.Count)
+    }
+    sb.WriteString( `</svg>`)
+    return template.HTML( sb.String())
+}
+
+// for latlearn's internal use only
+func html_row_of( sd SpanData) (r html_row) {
+    r            = html_row{ Name: sd.Name, Parent: sd.Parent, Completed: sd.Completed, P50: -1, P90: -1, P99: -1}
+    if !sd.Completed { return r}
+
+    r.Min, r.Last, r.Max, r.Mean, r.Weight = sd.Min, sd.Last, sd.Max, sd.Mean, int64( sd.Weight)
+    r.Tf         = sd.Time_frac
+    r.Tf_pct     = fmt.Sprintf( "%.2f%%", math.Min( 100, sd.Time_frac * 100))
+    for _, pq   := range []struct { p *int64; q float64 } { { &r.P50, 0.5}, { &r.P90, 0.9}, { &r.P99, 0.99}} {
+        if ns, ok := sd.Quantile( pq.q); ok { *pq.p = ns}
+    }
+    r.Hist_svg   = hist_svg(   sd.Hist)
+    r.Series_svg = series_svg( sd.Series)
+    return r
+}
+
+// Writes rd as one self-contained HTML file. See the comment at the top of
+// report_html.go for what is in it.
+func WriteReportHTML( w io.Writer, rd *ReportData) (err error) {
+    view       := html_view{ Title: "Latency Report", Fields: report_fields( rd), Params: rd.Params, Meta: rd.Meta}
+
+    // group into families, in order of each family's first span
+    fam_of     := map[string]int {}
+    for _, sd  := range rd.Spans {
+        root   := sd.Name
+        if (sd.Parent != "") { root = sd.Parent}
+        fi, found := fam_of[ root]
+        if !found {
+            fi  = len( view.Families)
+            fam_of[ root]  = fi
+            view.Families  = append( view.Families, html_family{})
+        }
+        r      := html_row_of( sd)
+        if (sd.Parent == "") {
+            // the parent leads its family, even if a variant came first
+            view.Families[ fi].Rows = append( []html_row { r}, view.Families[ fi].Rows...)
+        } else {
+            view.Families[ fi].Rows = append( view.Families[ fi].Rows, r)
+        }
+    }
+    for fi     := range view.Families {
+        rows   := view.Families[ fi].Rows
+        if (len( rows) > 1) && (rows[ 0].Parent == "") { view.Families[ fi].Rows[ 0].Is_family = true}
+    }
+
+    return html_report_tmpl.Execute( w, view)
+}
+
+// for latlearn's internal use only
+func report_html( fpath string, rd ReportData) (ok bool) {
+    pre      := "latlearn.report_html"
+
+    f, err   := os.Create( fpath)
+    if (err != nil) {
+        log.Printf( "%s: could not create html report: path '%s', err %#v\n", pre, fpath, err)
+        return false
+    }
+    defer f.Close()
+
+    if err = WriteReportHTML( f, &rd); (err != nil) {
+        log.Printf( "%s: could not write html report: path '%s', err %#v\n", pre, fpath, err)
+        return false
+    }
+    return true
+}
+
+var html_report_tmpl = template.Must( template.New( "report").Funcs( template.FuncMap{
+    "ns": func( n int64) string { if (n < 0) { return "?"}; return number_grouped( n, ",")},
+}).Parse( `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font: 14px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; }
+table { border-collapse: collapse; }
+th, td { padding: 3px 8px; text-align: right; white-space: nowrap; }
+th { background: #eee; cursor: pointer; user-select: none; position: sticky; top: 0; }
+th.sorted-asc::after { content: " \25B2"; } th.sorted-desc::after { content: " \25BC"; }
+td.name, th.name { text-align: left; font-family: Menlo, Consolas, monospace; }
+tbody { border-top: 1px solid #ddd; }
+tr.variant td.name { padding-left: 2em; color: #555; }
+tbody.collapsed tr.variant { display: none; }
+.toggle { cursor: pointer; display: inline-block; width: 1em; color: #888; }
+tbody.collapsed .toggle::before { content: "\25B8"; } tbody:not(.collapsed) .toggle::before { content: "\25BE"; }
+.unsampled td { color: #aaa; }
+.tf { display: inline-block; width: 80px; height: 10px; background: #eee; vertical-align: middle; margin-right: 4px; }
+.tf span { display: block; height: 100%; background: #e07b39; }
+svg rect { fill: #4a7ab0; } svg.series rect { fill: #5a9a5a; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 0 1em; font-size: 12px; }
+dt { color: #666; } dd { margin: 0; font-family: Menlo, Consolas, monospace; }
+details { margin: 1em 0; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Params}}<p>{{range $i, $p := .Params}}{{if $i}}, {{end}}{{$p}}{{end}}</p>{{end}}
+{{if .Meta}}<dl>{{range .Meta}}<dt>{{.Key}}</dt><dd>{{.Value}}</dd>{{end}}</dl>{{end}}
+<details><summary>Process &amp; host</summary>
+<dl>{{range .Fields}}<dt>{{.Key}}</dt><dd>{{.Value}}</dd>{{end}}</dl>
+</details>
+<p>Latencies in ns. Click a column to sort, and a &#9662; to fold a span's variants.</p>
+<table id="spans">
+<thead><tr>
+<th class="name">span</th><th>min</th><th>last</th><th>max</th><th>mean</th>
+<th>p50</th><th>p90</th><th>p99</th><th>weight (B&amp;As)</th><th>time frac</th>
+<th data-nosort>histogram</th><th data-nosort>mean over time</th>
+</tr></thead>
+{{range .Families}}<tbody>
+{{range .Rows}}<tr class="{{if .Parent}}variant{{end}}{{if not .Completed}} unsampled{{end}}">
+<td class="name" data-v="{{.Name}}">{{if .Is_family}}<span class="toggle"></span>{{end}}{{.Name}}</td>
+{{if .Completed}}<td data-v="{{.Min}}">{{ns .Min}}</td><td data-v="{{.Last}}">{{ns .Last}}</td><td data-v="{{.Max}}">{{ns .Max}}</td><td data-v="{{.Mean}}">{{ns .Mean}}</td>
+<td data-v="{{.P50}}">{{ns .P50}}</td><td data-v="{{.P90}}">{{ns .P90}}</td><td data-v="{{.P99}}">{{ns .P99}}</td>
+<td data-v="{{.Weight}}">{{ns .Weight}}</td>
+<td data-v="{{.Tf}}"><span class="tf"><span style="width: {{.Tf_pct}}"></span></span>{{printf "%.6f" .Tf}}</td>
+<td>{{.Hist_svg}}</td><td>{{.Series_svg}}</td>
+{{else}}<td data-v="-1">?</td><td data-v="-1">?</td><td data-v="-1">?</td><td data-v="-1">?</td><td data-v="-1">?</td><td data-v="-1">?</td><td data-v="-1">?</td><td data-v="-1">?</td><td data-v="-1">?</td><td></td><td></td>{{end}}
+</tr>
+{{end}}</tbody>
+{{end}}</table>
+<script>
+(function() {
+    var table = document.getElementById("spans");
+    table.addEventListener("click", function(e) {
+        if (e.target.classList.contains("toggle")) { e.target.closest("tbody").classList.toggle("collapsed"); }
+    });
+    function key(tr, col) {
+        var v = tr.children[col].getAttribute("data-v");
+        var n = parseFloat(v);
+        return (col > 0 && !isNaN(n)) ? n : v;
+    }
+    function cmp(col, dir) {
+        return function(a, b) { var x = key(a, col), y = key(b, col); return (x < y ? -1 : x > y ? 1 : 0) * dir; };
+    }
+    var ths = table.querySelectorAll("thead th");
+    ths.forEach(function(th, col) {
+        if (th.hasAttribute("data-nosort")) { return; }
+        th.addEventListener("click", function() {
+            var dir = th.classList.contains("sorted-desc") ? 1 : -1; // numbers sort high to low first
+            if (col == 0) { dir = th.classList.contains("sorted-asc") ? -1 : 1; }
+            ths.forEach(function(h) { h.classList.remove("sorted-asc", "sorted-desc"); });
+            th.classList.add(dir > 0 ? "sorted-asc" : "sorted-desc");
+            // families sort by their lead row, and variants within each family
+            var bodies = Array.prototype.slice.call(table.tBodies);
+            bodies.forEach(function(tb) {
+                var rows = Array.prototype.slice.call(tb.rows);
+                var lead = rows.shift();
+                rows.sort(cmp(col, dir)).forEach(function(r) { tb.appendChild(r); });
+            });
+            bodies.sort(function(a, b) { return cmp(col, dir)(a.rows[0], b.rows[0]); });
+            bodies.forEach(function(tb) { table.appendChild(tb); });
+        });
+    });
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,44 @@
+package latlearn_test
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+
+    "."
+)
+
+func TestWriteReportHTML( t *testing.T) {
+    fn3   := span_row( "fn3", 400, 10)
+    fn3.Hist = []latlearn.HistBucket { { Lo: 192, Hi: 200, Count: 5}, { Lo: 576, Hi: 608, Count: 5}}
+    v1    := span_row( "fn3(n=1)", 200, 5)
+    v1.Parent = "fn3"
+    rd    := &latlearn.ReportData{ Params: []string { "level: 3"}, Spans: []latlearn.SpanData {
+                 v1, // a variant before its parent still goes under it
+                 { Name: "<script>alert(1)</script>", Min: -1, Last: -1, Max: -1, Mean: -1, Cumul: -1, Weight: -1},
+                 fn3}}
+
+    var buf bytes.Buffer
+    if err := latlearn.WriteReportHTML( &buf, rd); (err != nil) {
+        t.Fatalf( "WriteReportHTML: %v", err)
+    }
+    html  := buf.String()
+
+    if n := strings.Count( html, "<tbody>"); (n != 2) {
+        t.Errorf( "WriteReportHTML: want 2 families, got %d", n)
+    }
+    if (strings.Index( html, `data-v="fn3"`) > strings.Index( html, `data-v="fn3(n=1)"`)) || !strings.Contains( html, `class="toggle"`) {
+        t.Errorf( "WriteReportHTML: want fn3 leading its family, with a toggle")
+    }
+    if strings.Contains( html, "<script>alert") {
+        t.Errorf( "WriteReportHTML: span name was not escaped")
+    }
+    if !strings.Contains( html, `<svg class="hist"`) || !strings.Contains( html, "level: 3") || !strings.Contains( html, "host.os") {
+        t.Errorf( "WriteReportHTML: want a histogram, the params and the header")
+    }
+    for _, ext := range []string { "src=", "href=", "@import", "url(", "http:", "https:"} {
+        if strings.Contains( html, ext) {
+            t.Errorf( "WriteReportHTML: want no external references, found %s", ext)
+        }
+    }
+}
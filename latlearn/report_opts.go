@@ -0,0 +1,176 @@
+// report_opts.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "fmt"
+    "regexp"
+    "sort"
+    "strings"
+)
+
+// Which span rows a report shows, and in what order. The zero value shows
+// them all, in the order first sampled, as reports always have. Applied the
+// same to the text, JSON and HTML reports. Only rows are dropped: each span's
+// Time_frac is still of the whole run.
+type ReportOpts struct {
+    Sort     string   // "name", "min", "last", "max", "mean", "cumul", "weight" or "tf" (time frac). numbers sort greatest first. "" keeps the order first sampled
+    Include  []string // patterns, as for Budget. if any, a span is shown only if its name matches one
+    Exclude  []string // patterns. a span whose name matches any is not shown
+    Top_n    int      // show only the N spans with the greatest time frac. 0 means all
+    Only     string   // "parents": only spans which are not variants. "variants": only variants. "" means both
+    Collapse bool     // hide each variant whose parent is shown: its samples are in the parent's row already
+    Group    bool     // show each variant right after its parent (still in Sort order, within the family)
+}
+
+// Applied to every report. See ReportOpts.
+var Report_opts ReportOpts
+
+// The keys ReportOpts.Sort accepts.
+var Report_sort_keys = []string { "name", "min", "last", "max", "mean", "cumul", "weight", "tf"}
+
+// Returns a copy of rd holding only the span rows opts shows, in its order.
+// The Report_opts field of the copy says what was applied. In order: Include
+// and Exclude, Only, Collapse, Top_n, then Sort and Group.
+func ApplyReportOpts( rd *ReportData, opts ReportOpts) (shaped *ReportData, err error) {
+    pre        := "latlearn.ApplyReportOpts"
+
+    if err = opts.check(); (err != nil) { return nil, fmt.Errorf( "%s: %v", pre, err)}
+    less       := report_sort_less( opts.Sort)
+    includes, _ := compile_patterns( opts.Include)
+    excludes, _ := compile_patterns( opts.Exclude)
+    matches    := func( res []*regexp.Regexp, name string) bool {
+        for _, re := range res {
+            if re.MatchString( name) { return true}
+        }
+        return false
+    }
+
+    shown      := map[string]bool {}
+    spans      := []SpanData {}
+    for _, sd  := range rd.Spans {
+        if (len( includes) > 0) && !matches( includes, sd.Name) { continue}
+        if matches( excludes, sd.Name)                          { continue}
+        if (opts.Only == "parents")  && (sd.Parent != "")       { continue}
+        if (opts.Only == "variants") && (sd.Parent == "")       { continue}
+        spans   = append( spans, sd)
+        shown[ sd.Name] = true
+    }
+    if opts.Collapse {
+        kept   := []SpanData {}
+        for _, sd := range spans {
+            if (sd.Parent != "") && shown[ sd.Parent] { continue}
+            kept = append( kept, sd)
+        }
+        spans   = kept
+    }
+    if (opts.Top_n > 0) && (len( spans) > opts.Top_n) {
+        by_tf  := append( []SpanData {}, spans...)
+        sort.SliceStable( by_tf, func( i, j int) bool { return by_tf[ i].Time_frac > by_tf[ j].Time_frac})
+        top    := map[string]bool {}
+        for _, sd := range by_tf[ :opts.Top_n] {
+            top[ sd.Name] = true
+        }
+        kept   := []SpanData {}
+        for _, sd := range spans {
+            if top[ sd.Name] { kept = append( kept, sd)}
+        }
+        spans   = kept
+    }
+    sort.SliceStable( spans, func( i, j int) bool { return less( spans[ i], spans[ j])})
+    if opts.Group {
+        spans   = report_grouped( spans)
+    }
+
+    copied     := *rd
+    copied.Spans       = spans
+    copied.Report_opts = opts.String()
+    return &copied, nil
+}
+
+// for latlearn's internal use only
+//
+// An error if opts has an unknown sort key or only, or a bad pattern.
+func (opts ReportOpts) check() (err error) {
+    if (report_sort_less( opts.Sort) == nil) {
+        return fmt.Errorf( "unknown sort key '%s'. want one of %v", opts.Sort, Report_sort_keys)
+    }
+    if (opts.Only != "") && (opts.Only != "parents") && (opts.Only != "variants") {
+        return fmt.Errorf( "unknown only '%s'. want parents or variants", opts.Only)
+    }
+    if _, err = compile_patterns( opts.Include); (err != nil) { return err}
+    if _, err = compile_patterns( opts.Exclude); (err != nil) { return err}
+    return nil
+}
+
+// for latlearn's internal use only
+func compile_patterns( patterns []string) (res []*regexp.Regexp, err error) {
+    for _, pattern := range patterns {
+        re, err := glob_regexp( pattern)
+        if (err != nil) { return nil, fmt.Errorf( "bad span pattern '%s': %v", pattern, err)}
+        res      = append( res, re)
+    }
+    return res, nil
+}
+
+// Describes the non-default opts, like "sort mean, top 20, exclude LL.*". ""
+// if none.
+func (opts ReportOpts) String() string {
+    parts      := []string {}
+    if (opts.Sort         != "") { parts = append( parts, "sort "    + opts.Sort)}
+    if (len( opts.Include) > 0)  { parts = append( parts, "include " + strings.Join( opts.Include, " "))}
+    if (len( opts.Exclude) > 0)  { parts = append( parts, "exclude " + strings.Join( opts.Exclude, " "))}
+    if (opts.Only         != "") { parts = append( parts, "only "    + opts.Only)}
+    if opts.Collapse             { parts = append( parts, "collapse")}
+    if (opts.Top_n         > 0)  { parts = append( parts, fmt.Sprintf( "top %d", opts.Top_n))}
+    if opts.Group                { parts = append( parts, "group")}
+    return strings.Join( parts, ", ")
+}
+
+// for latlearn's internal use only
+//
+// Whether a sorts before b, by key. nil if key is unknown. Spans with no
+// samples (whose metrics are -1) sort last either way.
+func report_sort_less( key string) func( a SpanData, b SpanData) bool {
+    var metric func( sd SpanData) float64
+    switch key {
+        case "":       return func( a SpanData, b SpanData) bool { return false}
+        case "name":   return func( a SpanData, b SpanData) bool { return a.Name < b.Name}
+        case "min":    metric = func( sd SpanData) float64 { return float64( sd.Min)}
+        case "last":   metric = func( sd SpanData) float64 { return float64( sd.Last)}
+        case "max":    metric = func( sd SpanData) float64 { return float64( sd.Max)}
+        case "mean":   metric = func( sd SpanData) float64 { return float64( sd.Mean)}
+        case "cumul":  metric = func( sd SpanData) float64 { return float64( sd.Cumul)}
+        case "weight": metric = func( sd SpanData) float64 { return float64( sd.Weight)}
+        case "tf":     metric = func( sd SpanData) float64 { return sd.Time_frac}
+        default:       return nil
+    }
+    return func( a SpanData, b SpanData) bool {
+        if (a.Completed != b.Completed) { return a.Completed}
+        return metric( a) > metric( b)
+    }
+}
+
+// for latlearn's internal use only
+//
+// spans, but with each variant moved to just after its parent, keeping their
+// order otherwise. A variant whose parent is not in spans stays where it is.
+func report_grouped( spans []SpanData) (grouped []SpanData) {
+    present    := map[string]bool {}
+    for _, sd  := range spans {
+        if (sd.Parent == "") { present[ sd.Name] = true}
+    }
+    variants   := map[string][]SpanData {}
+    for _, sd  := range spans {
+        if (sd.Parent != "") && present[ sd.Parent] {
+            variants[ sd.Parent] = append( variants[ sd.Parent], sd)
+        }
+    }
+    for _, sd  := range spans {
+        if (sd.Parent != "") && present[ sd.Parent] { continue}
+        grouped = append( grouped, sd)
+        if (sd.Parent == "") { grouped = append( grouped, variants[ sd.Name]...)}
+    }
+    return grouped
+}
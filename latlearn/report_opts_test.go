@@ -0,0 +1,75 @@
+package latlearn_test
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+
+    "."
+)
+
+func TestApplyReportOpts( t *testing.T) {
+    variant := func( name string, parent string, mean int64, tf float64) latlearn.SpanData {
+        sd          := span_row( name, mean, 10)
+        sd.Parent    = parent
+        sd.Time_frac = tf
+        return sd
+    }
+    never := latlearn.SpanData{ Name: "never", Min: -1, Last: -1, Max: -1, Mean: -1, Cumul: -1, Weight: -1}
+    rd    := &latlearn.ReportData{ Spans: []latlearn.SpanData {
+                 variant( "LL.no-op",  "",    5,   0.01),
+                 variant( "fn3(n=1)",  "fn3", 100, 0.10),
+                 never,
+                 variant( "fn3",       "",    300, 0.40),
+                 variant( "fn2",       "",    200, 0.05),
+                 variant( "fn3(n=10)", "fn3", 500, 0.30)}}
+    names := func( rd *latlearn.ReportData) string {
+        out := []string {}
+        for _, sd := range rd.Spans { out = append( out, sd.Name)}
+        return strings.Join( out, " ")
+    }
+
+    cases := []struct {
+        opts latlearn.ReportOpts
+        want string
+    } {
+        { latlearn.ReportOpts{},                                      "LL.no-op fn3(n=1) never fn3 fn2 fn3(n=10)"},
+        { latlearn.ReportOpts{ Sort: "mean"},                         "fn3(n=10) fn3 fn2 fn3(n=1) LL.no-op never"},
+        { latlearn.ReportOpts{ Sort: "name", Exclude: []string { "LL.*"}}, "fn2 fn3 fn3(n=1) fn3(n=10) never"},
+        { latlearn.ReportOpts{ Include: []string { "re:^fn3"}},       "fn3(n=1) fn3 fn3(n=10)"},
+        { latlearn.ReportOpts{ Only: "parents", Sort: "tf"},          "fn3 fn2 LL.no-op never"},
+        { latlearn.ReportOpts{ Only: "variants"},                     "fn3(n=1) fn3(n=10)"},
+        { latlearn.ReportOpts{ Collapse: true},                       "LL.no-op never fn3 fn2"},
+        { latlearn.ReportOpts{ Top_n: 2},                             "fn3 fn3(n=10)"},
+        { latlearn.ReportOpts{ Sort: "mean", Group: true},            "fn3 fn3(n=10) fn3(n=1) fn2 LL.no-op never"},
+        { latlearn.ReportOpts{ Sort: "weight", Exclude: []string { "fn3"}, Group: true}, "LL.no-op fn3(n=1) fn2 fn3(n=10) never"},
+    }
+    for _, c := range cases {
+        got, err := latlearn.ApplyReportOpts( rd, c.opts)
+        if (err != nil) || (names( got) != c.want) {
+            t.Errorf( "ApplyReportOpts( %q): want '%s', got '%s', %v", c.opts.String(), c.want, names( got), err)
+            continue
+        }
+        if (got.Report_opts != c.opts.String()) {
+            t.Errorf( "ApplyReportOpts( %q): Report_opts is '%s'", c.opts.String(), got.Report_opts)
+        }
+    }
+    if (len( rd.Spans) != 6) || (rd.Report_opts != "") {
+        t.Errorf( "ApplyReportOpts changed its input: %#v", rd)
+    }
+
+    for _, bad := range []latlearn.ReportOpts { { Sort: "speed"}, { Only: "children"}, { Include: []string { "re:("}}} {
+        if _, err := latlearn.ApplyReportOpts( rd, bad); (err == nil) {
+            t.Errorf( "ApplyReportOpts( %#v): want an error", bad)
+        }
+    }
+
+    // the opts applied survive a trip through a text report
+    shaped, _ := latlearn.ApplyReportOpts( rd, latlearn.ReportOpts{ Sort: "tf", Top_n: 3})
+    var buf bytes.Buffer
+    latlearn.WriteReport( &buf, shaped)
+    back, err := latlearn.ParseReport( &buf)
+    if (err != nil) || (back.Report_opts != "sort tf, top 3") || (names( back) != "fn3 fn3(n=10) fn3(n=1)") {
+        t.Errorf( "ParseReport of a shaped report: got %v, '%s', '%s'", err, back.Report_opts, names( back))
+    }
+}
@@ -0,0 +1,292 @@
+// report_parse.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+)
+
+// One "key: value" line from the header of a text report, as written.
+type ReportField struct {
+    Key   string `json:"key"`
+    Value string `json:"value"`
+}
+
+// for latlearn's internal use only
+//
+// Parses a number as printed in a report, like "62,863,418,151 ns" or
+// "9,223,372,036,854,775,807 bytes" or "4". Any "?" means unknown, so -1.
+func parse_grouped_int( txt string) (val int64, err error) {
+    txt     = strings.TrimSpace( txt)
+    if   i := strings.IndexByte( txt, ' '); (i != -1) { txt = txt[:i]} // drop any unit suffix
+    if strings.Contains( txt, "?") { return -1, nil}
+    return strconv.ParseInt( strings.ReplaceAll( txt, ",", ""), 10, 64)
+}
+
+// for latlearn's internal use only
+func parse_report_field( rd *ReportData, key string, value string) {
+    b       := func() bool   { return (value == "true")}
+    n       := func() int64  { v, _ := parse_grouped_int( value); return v}
+    s       := func() string { if (value == "?") { return ""}; return value}
+    f       := func() float64 {
+        v, _ := strconv.ParseFloat( strings.TrimSuffix( value, " cpus"), 64)
+        return v
+    }
+
+    switch key {
+        case "Outer_queue_capacity":      rd.Outer_queue_capacity      = int( n())
+        case "Inner_queue_capacity":      rd.Inner_queue_capacity      = int( n())
+        case "Overhead_samples_started":  rd.Overhead_samples_started  = b()
+        case "Overhead_samples_finished": rd.Overhead_samples_finished = b()
+        case "Overhead_samples_aborted":  rd.Overhead_samples_aborted  = b()
+        case "Benchmarks_started":        rd.Benchmarks_started        = b()
+        case "Benchmarks_finished":       rd.Benchmarks_finished       = b()
+        case "Benchmarks_aborted":        rd.Benchmarks_aborted        = b()
+        case "Should_report_builtins":    rd.Should_report_builtins    = b()
+        case "Should_subtract_overhead":  rd.Should_subtract_overhead  = b()
+        case "latlearn_should_subtract_overhead": rd.Should_subtract_overhead = b() // older reports
+        case "Report_opts":               rd.Report_opts               = value
+        case "since LL init":             rd.Since_init                = n()
+        case "Go ver":                    rd.Go_version                = value
+        case "GOARCH":                    rd.GOARCH                    = value
+        case "GOOS":                      rd.GOOS                      = value
+        case "NumCPU":                    rd.NumCPU                    = int( n())
+        case "GOMAXPROCS":                rd.GOMAXPROCS                = int( n())
+        case "NumGoroutine":              rd.NumGoroutine              = int( n())
+        case "SetMemoryLimit":            rd.Mem_limit                 = n()
+        case "GOGC":                      rd.GOGC                      = value
+
+        case "host.os":                   rd.Host.OS                   = s()
+        case "host.os_release":           rd.Host.OS_release           = s()
+        case "host.kernel":               rd.Host.Kernel               = s()
+        case "host.cpu_model":            rd.Host.Cpu_model            = s()
+        case "host.cpu_cores":            rd.Host.Cpu_cores            = int( max( n(), 0))
+        case "host.cpu_threads":          rd.Host.Cpu_threads          = int( max( n(), 0))
+        case "host.cpu_freq":             rd.Host.Cpu_freq_hz          = max( n(), 0)
+        case "host.cpu_freq_max":         rd.Host.Cpu_freq_max_hz      = max( n(), 0)
+        case "host.cpu_governor":         rd.Host.Cpu_governor         = s()
+        case "host.mem":                  rd.Host.Mem_bytes            = max( n(), 0)
+        case "host.page":                 rd.Host.Page_bytes           = max( n(), 0)
+        case "host.cgroup_cpu_limit":     rd.Host.Cgroup_cpu_limit     = f()
+        case "host.cgroup_mem_limit":     rd.Host.Cgroup_mem_limit_bytes = max( n(), 0)
+
+        // older Mac reports only had the raw sysctl lines. so we map them
+        // into the normalized host fields, unless those were present too
+        case "kern.version":              if (rd.Host.Kernel      == "") { rd.Host.Kernel      = value}
+        case "machdep.cpu.brand_string":  if (rd.Host.Cpu_model   == "") { rd.Host.Cpu_model   = value}
+        case "machdep.cpu.core_count":    if (rd.Host.Cpu_cores   == 0)  { rd.Host.Cpu_cores   = int( max( n(), 0))}
+        case "machdep.cpu.thread_count":  if (rd.Host.Cpu_threads == 0)  { rd.Host.Cpu_threads = int( max( n(), 0))}
+        case "hw.memsize":                if (rd.Host.Mem_bytes   == 0)  { rd.Host.Mem_bytes   = max( n(), 0)}
+        case "hw.pagesize":               if (rd.Host.Page_bytes  == 0)  { rd.Host.Page_bytes  = max( n(), 0)}
+        case "hw.cpufrequency":           if (rd.Host.Cpu_freq_hz == 0)  { rd.Host.Cpu_freq_hz = max( n(), 0)}
+        case "kern.osproductversion":     if (rd.Host.OS_release  == "") { rd.Host.OS_release  = "macOS " + value}
+
+        default:
+            if strings.HasPrefix( key, "build.")   { parse_build_info_field(      &rd.Build,   key, value)}
+            if strings.HasPrefix( key, "runtime.") { parse_runtime_metrics_field( &rd.Runtime, key, value)}
+    }
+}
+
+// for latlearn's internal use only
+//
+// Parses one row of the span table, like:
+//     "fn2       :   0 |   8 | 13,129 |  20 | w     100,234 | tf 0.000154 | fn2"
+func parse_span_row( line string) (sd SpanData, err error) {
+    cols      := strings.Split( line, " | ")
+    if (len( cols) < 7) {
+        return sd, fmt.Errorf( "want at least 7 columns, got %d", len( cols))
+    }
+
+    // the name is the last field. the 1st column also has it, padded, before
+    // the min. but since a name may contain ":" we take it from the end
+    sd.Name    = strings.TrimSpace( cols[6])
+    i         := strings.LastIndex( cols[0], ":")
+    if (i     == -1) {
+        return sd, fmt.Errorf( "no ':' after the span name")
+    }
+    if (sd.Name == "") {
+        sd.Name = strings.TrimSpace( cols[0][:i])
+    }
+    if (sd.Name == "") {
+        return sd, fmt.Errorf( "no span name")
+    }
+
+    weight_txt, found1 := strings.CutPrefix( strings.TrimSpace( cols[4]), "w ")
+    tf_txt,     found2 := strings.CutPrefix( strings.TrimSpace( cols[5]), "tf ")
+    if (!found1 || !found2) {
+        return sd, fmt.Errorf( "weight or time frac column is malformed")
+    }
+
+    if strings.Contains( cols[0][i + 1:], "?") { // never completed
+        sd.Min, sd.Last, sd.Max, sd.Mean, sd.Cumul, sd.Weight = -1, -1, -1, -1, -1, -1
+        return sd, nil
+    }
+    sd.Completed  = true
+
+    nums         := []*int64 { &sd.Min, &sd.Last, &sd.Max, &sd.Mean}
+    txts         := []string { cols[0][i + 1:], cols[1], cols[2], cols[3]}
+    for j, txt   := range txts {
+        if *nums[j], err = parse_grouped_int( txt); (err != nil) { return sd, err}
+    }
+
+    weight, err  := parse_grouped_int( weight_txt)
+    if (err != nil) { return sd, err}
+    sd.Weight     = int( weight)
+
+    sd.Time_frac  = -1
+    if !strings.Contains( tf_txt, "?") {
+        if sd.Time_frac, err = strconv.ParseFloat( strings.TrimSpace( tf_txt), 64); (err != nil) { return sd, err}
+    }
+
+    // the text report does not show cumul. so this is the best we can recover
+    if (sd.Mean >= 0) && (sd.Weight >= 0) { sd.Cumul = sd.Mean * int64( sd.Weight)}
+    return sd, nil
+}
+
+// for latlearn's internal use only
+//
+// A variant's row does not say who its parent is. But its name is the
+// parent's name followed by "(variant)". So if there is such a row, link it.
+func link_variant_parents( spans []SpanData) {
+    names       := map[string]bool {}
+    for _, sd   := range spans {
+        names[ sd.Name] = true
+    }
+    for i       := range spans {
+        name    := spans[ i].Name
+        if !strings.HasSuffix( name, ")") { continue}
+        for j, c := range name {
+            if (c != '(') { continue}
+            if names[ name[:j]] {
+                spans[ i].Parent = name[:j]
+                break
+            }
+        }
+    }
+}
+
+// Reads a plain text report (like Report or Report2 write) back into a
+// ReportData. Header lines are kept, in order, in the Header field, and the
+// ones latlearn knows about are also set in their typed fields, including
+// the raw sysctl lines of older Mac reports, which get mapped into Host.
+// The params of ReportWith are read back into Meta.
+//
+// Some facts do not survive the trip through text. Cumul is estimated as
+// Mean * Weight. A never-completed span's metrics are all -1. And since
+// Report2 joins its params with ", " a param which itself contains ", "
+// comes back split in two.
+func ParseReport( r io.Reader) (rd *ReportData, err error) {
+    rd          = &ReportData{ Format: REPORT_FORMAT, Version: REPORT_FORMAT_VERSION, Params: []string {}, Spans: []SpanData {}}
+
+    scanner    := bufio.NewScanner( r)
+    scanner.Buffer( make( []byte, 64 * 1024), 1024 * 1024)
+
+    // blocks of lines (separated by blank lines) before the span table. the
+    // 1st is the title, then 2 blocks of "key: value" lines, then the params
+    blocks     := [][]string {}
+    block      := []string {}
+    in_table   := false
+    line_num   := 0
+
+    for scanner.Scan() {
+        line_num++
+        line   := strings.TrimRight( scanner.Text(), "\r")
+
+        if in_table {
+            if (strings.TrimSpace( line) == "") { continue}
+            sd, err := parse_span_row( line)
+            if (err != nil) {
+                return nil, fmt.Errorf( "latlearn.ParseReport: line %d: %v", line_num, err)
+            }
+            rd.Spans = append( rd.Spans, sd)
+            continue
+        }
+
+        if strings.HasPrefix( line, "span") && strings.Contains( line, "min (ns)") { // "span:" if no name is longer
+            in_table = true
+            continue
+        }
+
+        if (strings.TrimSpace( line) == "") {
+            if (len( block) > 0) { blocks = append( blocks, block)}
+            block   = []string {}
+            continue
+        }
+        block       = append( block, line)
+    }
+    if err = scanner.Err(); (err != nil) {
+        return nil, fmt.Errorf( "latlearn.ParseReport: %v", err)
+    }
+    if !in_table {
+        return nil, fmt.Errorf( "latlearn.ParseReport: no span table found. not a latlearn report?")
+    }
+    if (len( block) > 0) { blocks = append( blocks, block)}
+
+    for bi, block := range blocks {
+        if (bi == 0) && strings.HasPrefix( block[0], "Latency Report") { continue}
+        if (bi >= 2) && (block[0] == "params:") { rd.Meta = parse_meta_block( block[1:]); continue}
+
+        if (bi >= 3) || ((bi == len( blocks) - 1) && (bi >= 2) && !strings.HasPrefix( block[0], "Go ver")) {
+            for _, line := range block {
+                for _, param := range strings.Split( line, ", ") {
+                    rd.Params = append( rd.Params, strings.TrimSpace( param))
+                }
+            }
+            continue
+        }
+
+        for _, line := range block {
+            key, value, found := strings.Cut( line, ":")
+            if !found { continue}
+            key        = strings.TrimSpace( key)
+            value      = strings.TrimSpace( value)
+            rd.Header  = append( rd.Header, ReportField{ Key: key, Value: value})
+            parse_report_field( rd, key, value)
+        }
+    }
+
+    if (rd.Host.OS == "") { rd.Host.OS = rd.GOOS} // older reports had no host.os line
+
+    link_variant_parents( rd.Spans)
+    return rd, nil
+}
+
+// Reads a report in either of the formats latlearn writes: plain text (see
+// ParseReport) or JSON (see Report_json_fpath.) Tells them apart by whether
+// the first non-blank char is a '{'.
+func ReadReport( r io.Reader) (rd *ReportData, err error) {
+    data, err := io.ReadAll( r)
+    if (err != nil) {
+        return nil, fmt.Errorf( "latlearn.ReadReport: %v", err)
+    }
+
+    if !bytes.HasPrefix( bytes.TrimSpace( data), []byte( "{")) {
+        return ParseReport( bytes.NewReader( data))
+    }
+
+    rd         = &ReportData{}
+    if err     = json.Unmarshal( data, rd); (err != nil) {
+        return nil, fmt.Errorf( "latlearn.ReadReport: %v", err)
+    }
+    if (rd.Format != REPORT_FORMAT) {
+        return nil, fmt.Errorf( "latlearn.ReadReport: not a latlearn report. format is '%s'", rd.Format)
+    }
+    return rd, nil
+}
+
+// Like ReadReport, but from the file at fpath.
+func ReadReportFile( fpath string) (rd *ReportData, err error) {
+    f, err := os.Open( fpath)
+    if (err != nil) { return nil, err}
+    defer f.Close()
+
+    return ReadReport( f)
+}
@@ -0,0 +1,97 @@
+package latlearn_test
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "."
+)
+
+func parse_report_file( t *testing.T, fpath string) *latlearn.ReportData {
+    f, err := os.Open( fpath)
+    if (err != nil) {
+        t.Fatalf( "could not open %s: %v", fpath, err)
+    }
+    defer f.Close()
+
+    rd, err := latlearn.ParseReport( f)
+    if (err != nil) {
+        t.Fatalf( "ParseReport %s: %v", fpath, err)
+    }
+    return rd
+}
+
+func find_span( rd *latlearn.ReportData, name string) (sd latlearn.SpanData, found bool) {
+    for _, sd := range rd.Spans {
+        if (sd.Name == name) { return sd, true}
+    }
+    return sd, false
+}
+
+func TestParseReport( t *testing.T) {
+    rd := parse_report_file( t, "../report-examples/latlearn-report.txt")
+
+    if (rd.Outer_queue_capacity != 1_000_000) || !rd.Benchmarks_finished || !rd.Should_subtract_overhead {
+        t.Errorf( "header fields: got %#v", rd)
+    }
+    if (rd.Since_init != 62_863_418_151) || (rd.Mem_limit != 9_223_372_036_854_775_807) || (rd.NumCPU != 4) {
+        t.Errorf( "header numbers: got since %d, mem limit %d, cpus %d", rd.Since_init, rd.Mem_limit, rd.NumCPU)
+    }
+    if (rd.Host.OS != "darwin") || (rd.Host.Cpu_cores != 2) || (rd.Host.Mem_bytes != 8_589_934_592) {
+        t.Errorf( "host mapped from sysctl lines: got %#v", rd.Host)
+    }
+    if (len( rd.Spans) != 44) {
+        t.Errorf( "span rows: want 44, got %d", len( rd.Spans))
+    }
+
+    fn2, _ := find_span( rd, "fn2")
+    if !fn2.Completed || (fn2.Max != 13_129) || (fn2.Weight != 100_234) || (fn2.Time_frac != 0.000154) {
+        t.Errorf( "fn2 row: got %#v", fn2)
+    }
+    v, _   := find_span( rd, "fn4(a=1000,b=15)")
+    if (v.Parent != "fn4") || (v.Mean != 22_571) {
+        t.Errorf( "fn4 variant row: got %#v", v)
+    }
+
+    rd      = parse_report_file( t, "../report-examples/latlearn-report-dynadj.txt")
+    sd, _  := find_span( rd, "LL.fn-call-return")
+    if sd.Completed || (sd.Min != -1) || (sd.Weight != -1) {
+        t.Errorf( "??? row: got %#v", sd)
+    }
+
+    // the older header layout, with 4-per-line params
+    rd      = parse_report_file( t, "../report-examples/slartboz.txt")
+    if !rd.Should_subtract_overhead || (rd.Since_init != 21_473_942_907) || (rd.GOOS != "darwin") {
+        t.Errorf( "older header fields: got %#v", rd)
+    }
+    if (len( rd.Params) < 4) || (rd.Params[0] != "cur6.4.20221231") || (rd.Params[1] != "vlc str 3.0.11") {
+        t.Errorf( "older params: got %#v", rd.Params)
+    }
+    if loop, found := find_span( rd, "loop"); !found || (loop.Weight != 317) {
+        t.Errorf( "older span row: got %#v", loop)
+    }
+}
+
+func FuzzParseReport( f *testing.F) {
+    fpaths, _ := filepath.Glob( "../report-examples/*.txt")
+    for _, fpath := range fpaths {
+        if data, err := os.ReadFile( fpath); (err == nil) {
+            f.Add( data)
+        }
+    }
+
+    f.Fuzz( func( t *testing.T, data []byte) {
+        rd, err := latlearn.ParseReport( bytes.NewReader( data))
+        if (err != nil) { return}
+        for _, sd := range rd.Spans {
+            if (sd.Name == "") {
+                t.Errorf( "parsed a span row with no name")
+            }
+            if !sd.Completed && (sd.Weight != -1) {
+                t.Errorf( "never completed span with a weight: %#v", sd)
+            }
+        }
+    })
+}
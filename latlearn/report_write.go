@@ -0,0 +1,94 @@
+// report_write.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "fmt"
+    "io"
+)
+
+// Writes rd as a text report, in the same layout as Report writes (so that
+// ParseReport can read it back.) For a ReportData made other than by a live
+// process, like by Replay or ReportOfState, the header has only what rd has.
+// The span rows are written as they are in rd: none are skipped.
+func WriteReport( w io.Writer, rd *ReportData) (err error) {
+    ew        := &err_writer{ w: w}
+    line      := func( format string, args ...any) { fmt.Fprintf( ew, format + "\n", args...)}
+
+    line( "Latency Report (https://github.com/mkramlich/latlearn)\n")
+
+    line( "Outer_queue_capacity:        %d", rd.Outer_queue_capacity)
+    line( "Inner_queue_capacity:        %d", rd.Inner_queue_capacity)
+    line( "Overhead_samples_started:    %v", rd.Overhead_samples_started)
+    line( "Overhead_samples_finished:   %v", rd.Overhead_samples_finished)
+    line( "Overhead_samples_aborted:    %v", rd.Overhead_samples_aborted)
+    line( "Benchmarks_started:          %v", rd.Benchmarks_started)
+    line( "Benchmarks_finished:         %v", rd.Benchmarks_finished)
+    line( "Benchmarks_aborted:          %v", rd.Benchmarks_aborted)
+    line( "Should_report_builtins:      %v", rd.Should_report_builtins)
+    line( "Should_subtract_overhead:    %v", rd.Should_subtract_overhead)
+    if rd.Should_subtract_overhead {
+        line( "metric treated as overhead:  %s, min", OVERHEAD_SPAN)
+    }
+    if (rd.Report_opts != "") {
+        line( "Report_opts:                 %s", rd.Report_opts)
+    }
+    line( "since LL init:               %s ns\n", number_grouped( rd.Since_init, ","))
+
+    line( "Go ver:                      %s", rd.Go_version)
+    line( "GOARCH:                      %s", rd.GOARCH)
+    line( "GOOS:                        %s", rd.GOOS)
+    line( "NumCPU:                      %d", rd.NumCPU)
+    line( "GOMAXPROCS:                  %d", rd.GOMAXPROCS)
+    line( "NumGoroutine:                %d", rd.NumGoroutine)
+    line( "SetMemoryLimit:              %s bytes", number_grouped( rd.Mem_limit, ","))
+    line( "GOGC:                        %s", rd.GOGC)
+    write_runtime_metrics_to_report( ew, rd.Runtime)
+    write_host_info_to_report( ew, rd.Host)
+    write_build_info_to_report( ew, rd.Build)
+    line( "")
+
+    // same layout as report_inner: 4 params per line
+    for i, param := range rd.Params {
+        switch {
+            case (i == 0):       fmt.Fprint( ew, param)
+            case ((i % 4) == 0): fmt.Fprint( ew, "\n" + param)
+            default:             fmt.Fprint( ew, ", " + param)
+        }
+    }
+    if (len( rd.Params) > 0) { line( "")}
+    line( "")
+    write_meta_to_report( ew, rd.Meta)
+
+    longest_name := len( "span")
+    for _, sd    := range rd.Spans {
+        if (len( sd.Name) > longest_name) { longest_name = len( sd.Name)}
+    }
+    name_field   := fmt.Sprintf( "%%-%ds", longest_name)
+    format       := name_field + ": %15s | %15s | %15s | %15s | %13s | %11s | %-21s"
+    header       := fmt.Sprintf( format, "span", "min (ns)", "last (ns)", "max (ns)", "mean (ns)", "weight (B&As)", "time frac", "span")
+    for _, sd    := range rd.Spans {
+        if (len( sd.Series) > 0) { header += " | mean over time"; break}
+    }
+    line( "%s", header)
+
+    for _, sd    := range rd.Spans {
+        line( "%s", span_row_txt( name_field, sd))
+    }
+    return ew.err
+}
+
+// for latlearn's internal use only
+//
+// Remembers the first write error, and skips all writes after it.
+type err_writer struct {
+    w   io.Writer
+    err error
+}
+
+func (ew *err_writer) Write( p []byte) (n int, err error) {
+    if (ew.err != nil) { return 0, ew.err}
+    n, ew.err = ew.w.Write( p)
+    return n, ew.err
+}
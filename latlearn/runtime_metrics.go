@@ -0,0 +1,156 @@
+// runtime_metrics.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "fmt"
+    "io"
+    "math"
+    "runtime/metrics"
+    "strings"
+)
+
+// Facts from the Go runtime (see runtime/metrics) as of a report, so that a
+// latency spike can be told apart from, or tied to, GC or the scheduler. The
+// counts and histograms are of the time since Init. Histogram bounds are in
+// ns, like a span's Hist. A metric this Go version lacks is left zero.
+type RuntimeMetrics struct {
+    Heap_live_bytes int64        `json:"heap_live_bytes"` // marked live by the last GC
+    Heap_goal_bytes int64        `json:"heap_goal_bytes"` // the heap size at which the next GC starts
+    Gc_cycles       int64        `json:"gc_cycles"`       // GC cycles completed since Init
+    Mutex_wait      int64        `json:"mutex_wait_ns"`   // summed over goroutines, blocked on a sync.Mutex or RWMutex since Init. approximate
+    Gc_pauses       []HistBucket `json:"gc_pauses,omitempty"`       // the stop-the-world pauses of the GC. only non-empty buckets
+    Sched_latencies []HistBucket `json:"sched_latencies,omitempty"` // how long goroutines sat runnable before running. only non-empty buckets
+}
+
+// for latlearn's internal use only
+const (
+    rm_heap_live   = "/gc/heap/live:bytes"
+    rm_heap_goal   = "/gc/heap/goal:bytes"
+    rm_gc_cycles   = "/gc/cycles/total:gc-cycles"
+    rm_mutex_wait  = "/sync/mutex/wait/total:seconds"
+    rm_gc_pauses   = "/sched/pauses/total/gc:seconds"
+    rm_sched_lats  = "/sched/latencies:seconds"
+)
+
+// for latlearn's internal use only
+//
+// The cumulative metrics as of Init, to subtract. Set by init_inner.
+var runtime_metrics_at_init []metrics.Sample
+
+// for latlearn's internal use only
+func read_runtime_metrics() (samples []metrics.Sample) {
+    for _, name := range []string { rm_heap_live, rm_heap_goal, rm_gc_cycles, rm_mutex_wait, rm_gc_pauses, rm_sched_lats} {
+        samples  = append( samples, metrics.Sample{ Name: name})
+    }
+    metrics.Read( samples)
+    return samples
+}
+
+// for latlearn's internal use only
+//
+// The RuntimeMetrics now, less those as of Init.
+func runtime_metrics() (rm RuntimeMetrics) {
+    base       := map[string]metrics.Value {}
+    for _, s   := range runtime_metrics_at_init {
+        base[ s.Name] = s.Value
+    }
+
+    for _, s   := range read_runtime_metrics() {
+        b, has_base := base[ s.Name]
+        switch s.Name {
+            case rm_heap_live:  if (s.Value.Kind() == metrics.KindUint64) { rm.Heap_live_bytes = int64( s.Value.Uint64())}
+            case rm_heap_goal:  if (s.Value.Kind() == metrics.KindUint64) { rm.Heap_goal_bytes = int64( s.Value.Uint64())}
+            case rm_gc_cycles:
+                if (s.Value.Kind() != metrics.KindUint64) { continue}
+                rm.Gc_cycles = int64( s.Value.Uint64())
+                if has_base && (b.Kind() == metrics.KindUint64) { rm.Gc_cycles -= int64( b.Uint64())}
+            case rm_mutex_wait:
+                if (s.Value.Kind() != metrics.KindFloat64) { continue}
+                secs        := s.Value.Float64()
+                if has_base && (b.Kind() == metrics.KindFloat64) { secs -= b.Float64()}
+                rm.Mutex_wait = int64( secs * 1e9)
+            case rm_gc_pauses:  rm.Gc_pauses       = runtime_hist_since( s.Value, b, has_base)
+            case rm_sched_lats: rm.Sched_latencies = runtime_hist_since( s.Value, b, has_base)
+        }
+    }
+    return rm
+}
+
+// for latlearn's internal use only
+//
+// The non-empty buckets of the histogram v, less the counts of base, with
+// their bounds made from seconds into ns. The open-ended first and last
+// buckets get bounds of 0 and double their other bound.
+func runtime_hist_since( v metrics.Value, base metrics.Value, has_base bool) (hbs []HistBucket) {
+    if (v.Kind() != metrics.KindFloat64Histogram) { return nil}
+    h          := v.Float64Histogram()
+
+    var bh *metrics.Float64Histogram
+    if has_base && (base.Kind() == metrics.KindFloat64Histogram) {
+        bh      = base.Float64Histogram()
+        if (len( bh.Counts) != len( h.Counts)) { bh = nil}
+    }
+
+    for i, count := range h.Counts {
+        if (bh != nil) { count -= bh.Counts[ i]}
+        if (count == 0) { continue}
+
+        lo     := h.Buckets[ i]
+        hi     := h.Buckets[ i + 1]
+        if math.IsInf( lo, -1) { lo = 0}
+        if math.IsInf( hi, +1) { hi = 2 * lo}
+        hbs     = append( hbs, HistBucket{ Lo: int64( lo * 1e9), Hi: int64( hi * 1e9), Count: int64( count)})
+    }
+    return hbs
+}
+
+// for latlearn's internal use only
+//
+// The text report's "runtime." lines. The histograms are summed up as their
+// p50 and p99, as the text has no room for them. "?" is unknown or empty.
+func runtime_metrics_fields( rm RuntimeMetrics) (fields []ReportField) {
+    num    := func( n int64) string { if (n <= 0) { return "?"}; return number_grouped( n, ",")}
+    pct    := func( hbs []HistBucket, q float64) string {
+        ns, ok := hist_quantile( hbs, q, -1, -1)
+        if !ok { return "?"}
+        return number_grouped( ns, ",")
+    }
+    add    := func( key string, value string) {
+        fields = append( fields, ReportField{ Key: key, Value: value})
+    }
+
+    add( "runtime.heap_live",         num( rm.Heap_live_bytes) + " bytes")
+    add( "runtime.heap_goal",         num( rm.Heap_goal_bytes) + " bytes")
+    add( "runtime.gc_cycles",         number_grouped( rm.Gc_cycles, ","))
+    add( "runtime.gc_pause_p50",      pct( rm.Gc_pauses, 0.50) + " ns")
+    add( "runtime.gc_pause_p99",      pct( rm.Gc_pauses, 0.99) + " ns")
+    add( "runtime.sched_latency_p50", pct( rm.Sched_latencies, 0.50) + " ns")
+    add( "runtime.sched_latency_p99", pct( rm.Sched_latencies, 0.99) + " ns")
+    add( "runtime.mutex_wait",        number_grouped( rm.Mutex_wait, ",") + " ns")
+    return fields
+}
+
+// for latlearn's internal use only
+func write_runtime_metrics_to_report( w io.Writer, rm RuntimeMetrics) {
+    for _, field := range runtime_metrics_fields( rm) {
+        io.WriteString( w, fmt.Sprintf( "%-29s%s\n", field.Key + ":", field.Value))
+    }
+}
+
+// for latlearn's internal use only
+//
+// The inverse of runtime_metrics_fields, for ParseReport, as far as it goes:
+// the histograms' percentiles can not be made back into histograms.
+func parse_runtime_metrics_field( rm *RuntimeMetrics, key string, value string) {
+    n, err := parse_grouped_int( strings.Fields( value + " ?")[ 0])
+    if (err != nil) || (n < 0) { return}
+
+    switch key {
+        case "runtime.heap_live":  rm.Heap_live_bytes = n
+        case "runtime.heap_goal":  rm.Heap_goal_bytes = n
+        case "runtime.gc_cycles":  rm.Gc_cycles       = n
+        case "runtime.mutex_wait": rm.Mutex_wait      = n
+    }
+}
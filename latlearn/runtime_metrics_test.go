@@ -0,0 +1,44 @@
+package latlearn_test
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+
+    "."
+)
+
+func TestRuntimeMetricsRoundTrip( t *testing.T) {
+    rm    := latlearn.RuntimeMetrics{
+                 Heap_live_bytes: 4 << 20, Heap_goal_bytes: 8 << 20, Gc_cycles: 12, Mutex_wait: 1500,
+                 Gc_pauses:       []latlearn.HistBucket { { Lo: 10000, Hi: 20000, Count: 99}, { Lo: 1000000, Hi: 2000000, Count: 1}},
+                 Sched_latencies: []latlearn.HistBucket { { Lo: 100, Hi: 200, Count: 10}}}
+    var buf bytes.Buffer
+    latlearn.WriteReport( &buf, &latlearn.ReportData{ Runtime: rm})
+    txt   := buf.String()
+    for _, want := range []string {
+        "runtime.heap_live:           4,194,304 bytes\n",
+        "runtime.gc_cycles:           12\n",
+        "runtime.gc_pause_p50:        15,050 ns\n",
+        "runtime.sched_latency_p99:   198 ns\n",
+        "runtime.mutex_wait:          1,500 ns\n"} {
+        if !strings.Contains( txt, want) {
+            t.Errorf( "WriteReport: want '%s' in:\n%s", strings.TrimSpace( want), txt)
+        }
+    }
+
+    back, err := latlearn.ParseReport( &buf)
+    if (err != nil) {
+        t.Fatalf( "ParseReport: %v", err)
+    }
+    got   := back.Runtime
+    if (got.Heap_live_bytes != rm.Heap_live_bytes) || (got.Heap_goal_bytes != rm.Heap_goal_bytes) || (got.Gc_cycles != 12) || (got.Mutex_wait != 1500) {
+        t.Errorf( "ParseReport: want the runtime scalars back, got %#v", got)
+    }
+
+    buf.Reset()
+    latlearn.WriteReport( &buf, &latlearn.ReportData{})
+    if !strings.Contains( buf.String(), "runtime.gc_pause_p99:        ? ns\n") {
+        t.Errorf( "WriteReport with no runtime metrics: want '?', got:\n%s", buf.String())
+    }
+}
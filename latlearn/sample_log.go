@@ -0,0 +1,226 @@
+// sample_log.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "time"
+)
+
+// The learners keep only aggregates, which lose the time order of samples.
+// So, optionally, the serve goroutine also appends every sample (or every
+// 1/ratio-th one) to a binary sample log, from which any statistic or time
+// series can be rebuilt offline, with ReadSampleLog.
+//
+// The log starts with SAMPLE_LOG_MAGIC, a version byte, and the init time (as
+// a varint of Unix ns.) Then it is a stream of records, each one a type byte
+// and varint fields:
+//
+//     'K' key id, name length, name, variant length, variant
+//         -- defines a span key, before its first sample
+//     'S' key id, t1 (ns since init), duration (ns), seq
+//         -- one sample. seq counts every sample the serve goroutine saw,
+//            logged or not, so gaps show where sampling (or the cap) skipped
+//
+// NOTE: These settings ONLY take effect if set BEFORE Init is called
+var Sample_log_fpath     string  = ""      // if set, samples are logged to this file (truncated at Init)
+var Sample_log_max_bytes int64   = 64 << 20 // once the log would grow past this, logging stops
+var Sample_log_ratio     float64 = 1.0     // fraction of samples to log, spread evenly. 1 is all
+
+var Sample_log_full      bool    = false // set once Sample_log_max_bytes was hit
+
+const SAMPLE_LOG_MAGIC   = "LLSLOG"
+const SAMPLE_LOG_VERSION = 1
+
+// owned by the serve goroutine
+type sampleLog struct {
+    f       *os.File
+    w       *bufio.Writer
+    ids     map[string]uint64
+    seq     uint64
+    acc     float64 // accumulates ratio, per sample. a sample is logged each time it passes 1
+    written int64
+    buf     []byte
+}
+
+// nil unless Sample_log_fpath was set at Init. owned by the serve goroutine
+var sample_log *sampleLog
+
+// for latlearn's internal use only
+func sample_log_open( fpath string) (sl *sampleLog) {
+    pre      := "latlearn.sample_log_open"
+
+    f, err   := os.Create( fpath)
+    if (err != nil) {
+        log.Printf( "%s: could not create sample log: path '%s', err %#v\n", pre, fpath, err)
+        return nil
+    }
+    sl        = &sampleLog{ f: f, w: bufio.NewWriterSize( f, 64 << 10), ids: map[string]uint64 {}}
+
+    sl.buf    = append( sl.buf[:0], SAMPLE_LOG_MAGIC...)
+    sl.buf    = append( sl.buf, SAMPLE_LOG_VERSION)
+    sl.buf    = binary.AppendVarint( sl.buf, init_time.UnixNano())
+    sl.write( sl.buf)
+    return sl
+}
+
+// for latlearn's internal use only
+func (sl *sampleLog) write( rec []byte) (ok bool) {
+    if Sample_log_full { return false}
+    if (sl.written + int64( len( rec)) > Sample_log_max_bytes) {
+        Sample_log_full = true
+        return false
+    }
+    n, _        := sl.w.Write( rec)
+    sl.written  += int64( n)
+    return true
+}
+
+// for latlearn's internal use only
+func (sl *sampleLog) add( name string, variant string, t1 time.Time, dur time.Duration) {
+    sl.seq++
+    sl.acc      += Sample_log_ratio
+    if (sl.acc < 1) || Sample_log_full { return}
+    sl.acc      -= 1
+
+    key         := span_key_form( name, variant)
+    id, found   := sl.ids[ key]
+    if !found {
+        id       = uint64( len( sl.ids))
+        sl.buf   = append( sl.buf[:0], 'K')
+        sl.buf   = binary.AppendUvarint( sl.buf, id)
+        sl.buf   = binary.AppendUvarint( sl.buf, uint64( len( name)))
+        sl.buf   = append( sl.buf, name...)
+        sl.buf   = binary.AppendUvarint( sl.buf, uint64( len( variant)))
+        sl.buf   = append( sl.buf, variant...)
+        if !sl.write( sl.buf) { return}
+        sl.ids[ key] = id
+    }
+
+    sl.buf       = append( sl.buf[:0], 'S')
+    sl.buf       = binary.AppendUvarint( sl.buf, id)
+    sl.buf       = binary.AppendVarint(  sl.buf, int64( t1.Sub( init_time)))
+    sl.buf       = binary.AppendVarint(  sl.buf, int64( dur))
+    sl.buf       = binary.AppendUvarint( sl.buf, sl.seq)
+    sl.write( sl.buf)
+}
+
+// for latlearn's internal use only
+func (sl *sampleLog) flush() {
+    if err := sl.w.Flush(); (err != nil) {
+        log.Printf( "latlearn.sampleLog.flush: err %#v\n", err)
+    }
+}
+
+// for latlearn's internal use only
+func (sl *sampleLog) close() {
+    sl.flush()
+    sl.f.Close()
+}
+
+// One sample, as read back from a sample log.
+type Sample struct {
+    Name    string
+    Variant string
+    Key     string        // the learners key. like "fn3(n=50)"
+    T1      time.Time
+    Dur     time.Duration
+    Seq     uint64
+}
+
+// Iterates the samples of a sample log. See ReadSampleLog.
+type SampleLogReader struct {
+    Init_time time.Time
+    r         *bufio.Reader
+    keys      map[uint64][2]string
+}
+
+// Starts reading a sample log, as written when Sample_log_fpath is set.
+// Call Next until it returns io.EOF. A log cut short, like by a crash, ends
+// with io.ErrUnexpectedEOF instead. Every sample before that is good.
+func ReadSampleLog( r io.Reader) (slr *SampleLogReader, err error) {
+    pre       := "latlearn.ReadSampleLog"
+
+    slr        = &SampleLogReader{ r: bufio.NewReader( r), keys: map[uint64][2]string {}}
+
+    head      := make( []byte, len( SAMPLE_LOG_MAGIC) + 1)
+    if _, err  = io.ReadFull( slr.r, head); (err != nil) || (string( head[:len( SAMPLE_LOG_MAGIC)]) != SAMPLE_LOG_MAGIC) {
+        return nil, fmt.Errorf( "%s: not a latlearn sample log", pre)
+    }
+    if (head[ len( SAMPLE_LOG_MAGIC)] != SAMPLE_LOG_VERSION) {
+        return nil, fmt.Errorf( "%s: unsupported version %d", pre, head[ len( SAMPLE_LOG_MAGIC)])
+    }
+    init_ns, err := binary.ReadVarint( slr.r)
+    if (err != nil) {
+        return nil, fmt.Errorf( "%s: bad header: %v", pre, err)
+    }
+    slr.Init_time = time.Unix( 0, init_ns)
+    return slr, nil
+}
+
+// for latlearn's internal use only
+func (slr *SampleLogReader) read_str() (s string, err error) {
+    n, err    := binary.ReadUvarint( slr.r)
+    if (err != nil) { return "", err}
+    if (n > 1 << 20) { return "", fmt.Errorf( "string too long: %d", n)}
+    b         := make( []byte, n)
+    _, err     = io.ReadFull( slr.r, b)
+    return string( b), err
+}
+
+// Returns the next sample, or io.EOF at the clean end of the log.
+func (slr *SampleLogReader) Next() (s Sample, err error) {
+    pre           := "latlearn.SampleLogReader.Next"
+
+    // any EOF past the start of a record means the log was cut short
+    short         := func( err error) error {
+        if errors.Is( err, io.EOF) { return io.ErrUnexpectedEOF}
+        return err
+    }
+
+    for {
+        ttype, err := slr.r.ReadByte()
+        if (err != nil) { return s, err} // io.EOF, between records, is the clean end
+
+        switch ttype {
+            case 'K':
+                id, err      := binary.ReadUvarint( slr.r)
+                if (err != nil) { return s, short( err)}
+                name, err    := slr.read_str()
+                if (err != nil) { return s, short( err)}
+                variant, err := slr.read_str()
+                if (err != nil) { return s, short( err)}
+                slr.keys[ id] = [2]string { name, variant}
+
+            case 'S':
+                id, err  := binary.ReadUvarint( slr.r)
+                if (err != nil) { return s, short( err)}
+                t1, err  := binary.ReadVarint( slr.r)
+                if (err != nil) { return s, short( err)}
+                dur, err := binary.ReadVarint( slr.r)
+                if (err != nil) { return s, short( err)}
+                seq, err := binary.ReadUvarint( slr.r)
+                if (err != nil) { return s, short( err)}
+
+                key, found := slr.keys[ id]
+                if !found { return s, fmt.Errorf( "%s: sample of undefined key id %d", pre, id)}
+                return Sample{
+                           Name:    key[ 0],
+                           Variant: key[ 1],
+                           Key:     span_key_form( key[ 0], key[ 1]),
+                           T1:      slr.Init_time.Add( time.Duration( t1)),
+                           Dur:     time.Duration( dur),
+                           Seq:     seq}, nil
+
+            default:
+                return s, fmt.Errorf( "%s: unknown record type %q", pre, ttype)
+        }
+    }
+}
@@ -0,0 +1,23 @@
+package latlearn_test
+
+import (
+    "strings"
+    "testing"
+
+    "."
+)
+
+func TestReadSampleLogBad( t *testing.T) {
+    for _, txt := range []string { "", "LLSLO", "NOTLOG\x01\x00", "LLSLOG\x09\x00"} {
+        if _, err := latlearn.ReadSampleLog( strings.NewReader( txt)); (err == nil) {
+            t.Errorf( "ReadSampleLog %q: want an error", txt)
+        }
+    }
+
+    // a sample of a key id never defined
+    slr, err := latlearn.ReadSampleLog( strings.NewReader( "LLSLOG\x01\x00S\x05\x00\x02\x01"))
+    if (err != nil) { t.Fatalf( "ReadSampleLog: %v", err)}
+    if _, err = slr.Next(); (err == nil) {
+        t.Errorf( "SampleLogReader.Next of an undefined key: want an error")
+    }
+}
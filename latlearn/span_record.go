@@ -0,0 +1,213 @@
+// span_record.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "runtime"
+    "sort"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// The learners keep only aggregates, which can not show what happened within
+// one frame of a loop. So, optionally, each span instance is also recorded:
+// its name, variant, T1, T2, goroutine, and how deep it was nested in other
+// spans on that goroutine. The serve goroutine keeps the most recent ones in
+// a ring, of Span_record_capacity (fixed once the first is recorded), which
+// SpanRecords returns and WriteChromeTrace writes in the Chrome Trace Event
+// Format, for chrome://tracing or Perfetto (opened from a local file.)
+//
+// Span_recording may be turned on or off at any time, like around a frame of
+// interest: a span is recorded only if it was on at B. While on, each B costs
+// a runtime.Stack call (about a µs) to learn the goroutine, as Go has no API
+// for it, and a lock to count the spans open on it. A span's B and A should
+// be on the same goroutine, else the Depth of later spans on it may be off.
+// Likewise, a recorded span which is never ended (by A or A2) stays counted
+// as open, so later spans on its goroutine get a Depth one too deep.
+var Span_recording       bool = false
+var Span_record_capacity int  = 10_000
+
+// One recorded span instance.
+type SpanRecord struct {
+    Name      string    `json:"name"`
+    Variant   string    `json:"variant,omitempty"` // as of A, so including any end variant
+    T1        time.Time `json:"t1"`
+    T2        time.Time `json:"t2"`
+    Goroutine int64     `json:"goroutine"` // the id runtime.Stack shows. 0 if unknown
+    Depth     int       `json:"depth"`     // recorded spans open on the goroutine at B. 0 is outermost
+}
+
+// owned by the serve goroutine
+type spanRing struct {
+    recs    []SpanRecord
+    next    int  // where the next record goes
+    full    bool // whether next has wrapped around
+}
+
+// nil until the first span is recorded. owned by the serve goroutine
+var span_ring *spanRing
+
+// for latlearn's internal use only
+//
+// Counts the recorded spans open on each goroutine, for their Depth.
+var span_open_mu sync.Mutex
+var span_open    = map[int64]int {}
+
+// for latlearn's internal use only
+//
+// The id of the calling goroutine, from the first line of its stack, like
+// "goroutine 18 [running]:". 0 if it could not be parsed.
+func goroutine_id() (id int64) {
+    var buf [64]byte
+    n      := runtime.Stack( buf[:], false)
+    line   := bytes.TrimPrefix( buf[:n], []byte( "goroutine "))
+    if i   := bytes.IndexByte( line, ' '); (i > 0) {
+        id, _ = strconv.ParseInt( string( line[:i]), 10, 64)
+    }
+    return id
+}
+
+// for latlearn's internal use only
+//
+// The id of the goroutine of B. Learned only once per span, as it costs a
+// runtime.Stack call, so only call it from B.
+func (ssu *SpanSampleUnderway) goroutine_of_b() (id int64) {
+    if (ssu.goroutine == 0) { ssu.goroutine = goroutine_id()}
+    return ssu.goroutine
+}
+
+// for latlearn's internal use only
+//
+// Called before T1 is taken, so is not in the sample.
+func (ssu *SpanSampleUnderway) record_before() {
+    ssu.goroutine_of_b()
+    span_open_mu.Lock()
+    ssu.rec_depth       = span_open[ ssu.goroutine]
+    span_open[ ssu.goroutine]++
+    span_open_mu.Unlock()
+    ssu.recorded        = true
+}
+
+// for latlearn's internal use only
+//
+// Called after T2 is taken.
+func (ssu *SpanSampleUnderway) record_after() {
+    span_open_mu.Lock()
+    if (span_open[ ssu.goroutine] <= 1) {
+        delete( span_open, ssu.goroutine)
+    } else {
+        span_open[ ssu.goroutine]--
+    }
+    span_open_mu.Unlock()
+}
+
+// for latlearn's internal use only
+func (sr *spanRing) add( rec SpanRecord) {
+    sr.recs[ sr.next] = rec
+    sr.next++
+    if (sr.next == len( sr.recs)) {
+        sr.next = 0
+        sr.full = true
+    }
+}
+
+// for latlearn's internal use only
+//
+// A copy of the records, oldest first.
+func (sr *spanRing) records() (recs []SpanRecord) {
+    if sr.full { recs = append( recs, sr.recs[ sr.next:]...)}
+    return append( recs, sr.recs[ :sr.next]...)
+}
+
+// for internal, latlearn-only, use
+func span_record_add( msg comm_msg) {
+    if (span_ring == nil) {
+        if (Span_record_capacity <= 0) { return}
+        span_ring = &spanRing{ recs: make( []SpanRecord, Span_record_capacity)}
+    }
+    span_ring.add( SpanRecord{ Name: msg.name, Variant: msg.variant, T1: msg.t1, T2: msg.t2, Goroutine: msg.goroutine, Depth: msg.depth})
+}
+
+// for internal, latlearn-only, use
+func handle_msg_span_records( msg comm_msg) {
+    if (msg.reply_chan == nil) { return}
+
+    reply      := ReplyMsg{ ttype: msg.ttype}
+    if (span_ring != nil) { reply.Records = span_ring.records()}
+    msg.reply_chan <- reply
+}
+
+// Returns a copy of the recorded spans (see Span_recording), in the order
+// they ended, oldest first.
+func SpanRecords() (recs []SpanRecord, ok bool) {
+    if (!init_completed || Serve_finished) { return nil, false}
+
+    reply_chan := make( chan ReplyMsg, 1)
+    comm_outer <- comm_msg{ ttype: "span-records", reply_chan: reply_chan}
+    reply      := <-reply_chan
+    return reply.Records, true
+}
+
+// for latlearn's internal use only
+//
+// One event of the Chrome Trace Event Format. ts and dur are in µs.
+type chromeTraceEvent struct {
+    Name  string         `json:"name"`
+    Cat   string         `json:"cat,omitempty"`
+    Ph    string         `json:"ph"`
+    Ts    float64        `json:"ts"`
+    Dur   float64        `json:"dur,omitempty"`
+    Pid   int            `json:"pid"`
+    Tid   int64          `json:"tid"`
+    Args  map[string]any `json:"args,omitempty"`
+}
+
+// Writes recs in the Chrome Trace Event Format (JSON), as one complete ("X")
+// event per span, named by its span key, with one track per goroutine. Times
+// are since the earliest T1 among them. Like with the records of SpanRecords.
+func WriteChromeTrace( w io.Writer, recs []SpanRecord) (err error) {
+    var t0 time.Time
+    for _, r   := range recs {
+        if t0.IsZero() || r.T1.Before( t0) { t0 = r.T1}
+    }
+    us         := func( d time.Duration) float64 { return float64( d) / 1e3}
+
+    // so a viewer sees outer spans before those nested in them
+    sorted     := append( []SpanRecord {}, recs...)
+    sort.SliceStable( sorted, func( i, j int) bool {
+        if !sorted[ i].T1.Equal( sorted[ j].T1) { return sorted[ i].T1.Before( sorted[ j].T1)}
+        return sorted[ i].Depth < sorted[ j].Depth
+    })
+
+    pid        := os.Getpid()
+    events     := []chromeTraceEvent {
+        { Name: "process_name", Ph: "M", Pid: pid, Args: map[string]any { "name": "latlearn"}}}
+    named      := map[int64]bool {}
+    for _, r   := range sorted {
+        if !named[ r.Goroutine] {
+            named[ r.Goroutine] = true
+            events = append( events, chromeTraceEvent{ Name: "thread_name", Ph: "M", Pid: pid, Tid: r.Goroutine,
+                Args: map[string]any { "name": fmt.Sprintf( "goroutine %d", r.Goroutine)}})
+        }
+        args   := map[string]any { "depth": r.Depth}
+        if (r.Variant != "") { args[ "variant"] = r.Variant}
+        events  = append( events, chromeTraceEvent{ Name: span_key_form( r.Name, r.Variant), Cat: "latlearn", Ph: "X",
+            Ts: us( r.T1.Sub( t0)), Dur: us( r.T2.Sub( r.T1)), Pid: pid, Tid: r.Goroutine, Args: args})
+    }
+
+    enc        := json.NewEncoder( w)
+    if err = enc.Encode( struct {
+        TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+        DisplayTimeUnit string             `json:"displayTimeUnit"`
+    }{ events, "ns"}); (err != nil) {
+        return fmt.Errorf( "latlearn.WriteChromeTrace: %v", err)
+    }
+    return nil
+}
@@ -0,0 +1,56 @@
+package latlearn_test
+
+import (
+    "bytes"
+    "encoding/json"
+    "testing"
+    "time"
+
+    "."
+)
+
+func TestWriteChromeTrace( t *testing.T) {
+    t0     := time.Unix( 1_700_000_000, 0)
+    recs   := []latlearn.SpanRecord {
+                  { Name: "frame/draw", T1: t0.Add( 2 * time.Millisecond), T2: t0.Add( 5 * time.Millisecond), Goroutine: 1, Depth: 1},
+                  { Name: "frame", Variant: "level=3", T1: t0.Add( time.Millisecond), T2: t0.Add( 9 * time.Millisecond), Goroutine: 1},
+                  { Name: "loader", T1: t0.Add( 3 * time.Millisecond), T2: t0.Add( 4 * time.Millisecond), Goroutine: 7}}
+
+    var buf bytes.Buffer
+    if err := latlearn.WriteChromeTrace( &buf, recs); (err != nil) {
+        t.Fatalf( "WriteChromeTrace: want no err, got %v", err)
+    }
+    var doc struct {
+        TraceEvents []struct {
+            Name string
+            Ph   string
+            Ts   float64
+            Dur  float64
+            Tid  int64
+            Args map[string]any
+        }
+    }
+    if err := json.Unmarshal( buf.Bytes(), &doc); (err != nil) {
+        t.Fatalf( "WriteChromeTrace: want JSON, got %v, in: %s", err, buf.String())
+    }
+
+    var xs, threads []string
+    for _, e := range doc.TraceEvents {
+        switch {
+            case (e.Ph == "X"):             xs      = append( xs, e.Name)
+            case (e.Name == "thread_name"): threads = append( threads, e.Args[ "name"].(string))
+        }
+        if (e.Ph == "X") && (e.Name == "frame(level=3)") && ((e.Ts != 0) || (e.Dur != 8000) || (e.Tid != 1)) {
+            t.Errorf( "WriteChromeTrace: want frame at 0 µs, for 8000 µs, on tid 1, got %v, %v, %d", e.Ts, e.Dur, e.Tid)
+        }
+        if (e.Ph == "X") && (e.Name == "frame/draw") && ((e.Ts != 1000) || (e.Args[ "depth"] != 1.0)) {
+            t.Errorf( "WriteChromeTrace: want frame/draw at 1000 µs, at depth 1, got %v, %v", e.Ts, e.Args[ "depth"])
+        }
+    }
+    if want := []string { "frame(level=3)", "frame/draw", "loader"}; (len( xs) != 3) || (xs[ 0] != want[ 0]) || (xs[ 1] != want[ 1]) || (xs[ 2] != want[ 2]) {
+        t.Errorf( "WriteChromeTrace: want X events %v, by T1, got %v", want, xs)
+    }
+    if (len( threads) != 2) || (threads[ 0] != "goroutine 1") || (threads[ 1] != "goroutine 7") {
+        t.Errorf( "WriteChromeTrace: want a track per goroutine, got %v", threads)
+    }
+}
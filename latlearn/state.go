@@ -0,0 +1,221 @@
+// state.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "time"
+)
+
+const STATE_FORMAT         = "latlearn-state"
+const STATE_FORMAT_VERSION = 1
+
+// A snapshot of every learner's raw stats, as written by SaveState and read
+// by LoadState. Unlike a report, nothing in it is overhead compensated or
+// derived, so it can be continued or merged without loss. The encoding is
+// JSON. Later versions may add fields but will not change the meaning of
+// these, and LoadState refuses a Version newer than it knows.
+type State struct {
+    Format     string      `json:"format"`  // always STATE_FORMAT
+    Version    int         `json:"version"` // STATE_FORMAT_VERSION, when written
+    Saved_at   time.Time   `json:"saved_at"`
+    Since_init int64       `json:"since_init_ns"` // how long the stats were gathered over
+    Label      string      `json:"label,omitempty"`   // where it came from. SaveState sets "hostname:pid"
+    Sources    []Source    `json:"sources,omitempty"` // set only by Merge
+    Meta       []Param     `json:"meta,omitempty"`    // context params, like of a report (see ReportWith.) a Merge keeps those all inputs share
+    Spans      []SpanState `json:"spans"`             // in tracked_spans order
+}
+
+// One of the inputs to a Merge: a State, or a report, from one process or run.
+type Source struct {
+    Label      string    `json:"label"`
+    Saved_at   time.Time `json:"saved_at"`
+    Since_init int64     `json:"since_init_ns"`
+    Meta       []Param   `json:"meta,omitempty"`
+}
+
+// The raw stats of one learner. Durations are in ns.
+type SpanState struct {
+    Name      string       `json:"name"`             // the learners key. like "fn3(n=50)"
+    Parent    string       `json:"parent,omitempty"` // set only for variants. like "fn3"
+    Completed bool         `json:"completed"`
+    Last      int64        `json:"last"`
+    Cumul     int64        `json:"cumul"`
+    Weight    int          `json:"weight"`
+    Min       int64        `json:"min"`
+    Max       int64        `json:"max"`
+    M2        float64      `json:"m2,omitempty"`   // sum of squared deviations from the mean, in ns^2
+    Hist      []HistBucket `json:"hist,omitempty"` // only the non-empty buckets
+    Sources   []int        `json:"sources,omitempty"` // set only by Merge. indexes into State.Sources, of those which sampled it
+}
+
+// for latlearn's internal use only
+func (ll *latencyLearner) span_state() (ss SpanState) {
+    return SpanState{
+               Name:      ll.Name,
+               Completed: ll.Pair_ever_completed,
+               Last:      int64( ll.Last),
+               Cumul:     int64( ll.Cumul),
+               Weight:    ll.Weight,
+               Min:       int64( ll.Min),
+               Max:       int64( ll.Max),
+               M2:        ll.m2,
+               Hist:      ll.hist_buckets()}
+}
+
+// for latlearn's internal use only
+//
+// Folds the stats of ss into those of ll, as if ll had also seen its samples.
+// ll's Last is kept, if it has one, as being the more recent.
+func (ll *latencyLearner) absorb( ss SpanState) {
+    if !ss.Completed || (ss.Weight < 1) { return}
+
+    if !ll.Pair_ever_completed || (ll.Weight < 1) {
+        ll.Last, ll.Min, ll.Max = time.Duration( ss.Last), time.Duration( ss.Min), time.Duration( ss.Max)
+        ll.m2                   = ss.M2
+    } else {
+        // Chan et al's parallel form of Welford's update
+        na, nb := float64( ll.Weight), float64( ss.Weight)
+        d      := (float64( ss.Cumul) / nb) - (float64( ll.Cumul) / na)
+        ll.m2  += ss.M2 + (d * d * na * nb / (na + nb))
+
+        if (time.Duration( ss.Min) < ll.Min) { ll.Min = time.Duration( ss.Min)}
+        if (time.Duration( ss.Max) > ll.Max) { ll.Max = time.Duration( ss.Max)}
+    }
+    ll.Cumul  += time.Duration( ss.Cumul)
+    ll.Weight += ss.Weight
+    for _, hb := range ss.Hist {
+        ll.hist_add( time.Duration( hb.Lo), hb.Count)
+    }
+    ll.Pair_ever_completed = true
+}
+
+// for latlearn's internal use only
+//
+// Finds (or makes, and tracks) the learner for ss, linked to its parent if a
+// variant. If the key is already known as the other kind, it is left so.
+func state_learner( ss SpanState) (ll *latencyLearner) {
+    if (ss.Parent == "") {
+        ll, found    := latency_learner( ss.Name)
+        if !found { tracked_spans = append( tracked_spans, ss.Name)}
+        return ll
+    }
+
+    pll, found       := latency_learner( ss.Parent)
+    if !found { tracked_spans = append( tracked_spans, ss.Parent)}
+
+    if lli, found    := learners[ ss.Name]; found {
+        return lli.getLL()
+    }
+    vll, _           := variant_latency_learner( ss.Name)
+    vll.parent        = pll
+    tracked_spans     = append( tracked_spans, ss.Name)
+    return vll.latencyLearner
+}
+
+// for latlearn's internal use only
+//
+// The sum of the Since_init of every State loaded, as its stats were gathered
+// over that time too. Added to it wherever time since Init is the whole the
+// stats are a share of, like for Time_frac. Owned by the serve goroutine.
+var loaded_since_init time.Duration
+
+// for internal, latlearn-only, use
+func handle_msg_save_state( msg comm_msg) {
+    msg.state.Format     = STATE_FORMAT
+    msg.state.Version    = STATE_FORMAT_VERSION
+    msg.state.Saved_at   = time.Now()
+    msg.state.Since_init = int64( time.Since( init_time) + loaded_since_init)
+    hostname, _         := os.Hostname()
+    msg.state.Label      = fmt.Sprintf( "%s:%d", hostname, os.Getpid())
+
+    for _, span := range tracked_spans {
+        lli, found  := learners[ span]
+        if !found || (lli == nil) { continue}
+        ss          := lli.getLL().span_state()
+        if vll      := lli.getVLL(); (vll != nil) && (vll.parent != nil) {
+            ss.Parent = vll.parent.Name
+        }
+        msg.state.Spans = append( msg.state.Spans, ss)
+    }
+
+    if (msg.done != nil) {
+        msg.done <- true
+    }
+}
+
+// for internal, latlearn-only, use
+func handle_msg_load_state( msg comm_msg) {
+    for _, ss := range msg.state.Spans {
+        state_learner( ss).absorb( ss)
+    }
+    if (msg.state.Since_init > 0) { loaded_since_init += time.Duration( msg.state.Since_init)}
+
+    if (msg.done != nil) {
+        msg.done <- true
+    }
+}
+
+// Writes the raw stats of every span, in report order, as a versioned State
+// (JSON.) Like for a restarted process, or an offline tool, to continue from
+// with LoadState. Must be called after Init.
+func SaveState( w io.Writer) (err error) {
+    if (!init_completed || Serve_finished) { return fmt.Errorf( "latlearn.SaveState: not running")}
+
+    state     := &State{}
+    done_chan := make( chan bool, 1)
+    comm_outer <- comm_msg{ ttype: "save-state", state:state, done:done_chan}
+    <- done_chan
+
+    enc       := json.NewEncoder( w)
+    enc.SetIndent( "", "  ")
+    if err = enc.Encode( state); (err != nil) {
+        return fmt.Errorf( "latlearn.SaveState: %v", err)
+    }
+    return nil
+}
+
+// Reads a State, as written by SaveState, without loading it. Errors if it
+// is not one, or is of a newer version than this code knows.
+func ReadState( r io.Reader) (state *State, err error) {
+    pre       := "latlearn.ReadState"
+
+    state      = &State{}
+    if err = json.NewDecoder( r).Decode( state); (err != nil) {
+        return nil, fmt.Errorf( "%s: %v", pre, err)
+    }
+    if (state.Format != STATE_FORMAT) {
+        return nil, fmt.Errorf( "%s: not a latlearn state: format '%s'", pre, state.Format)
+    }
+    if (state.Version < 1) || (state.Version > STATE_FORMAT_VERSION) {
+        return nil, fmt.Errorf( "%s: unsupported version %d (this reads up to %d)", pre, state.Version, STATE_FORMAT_VERSION)
+    }
+    for _, ss := range state.Spans {
+        if (ss.Name == "") || (ss.Weight < 0) {
+            return nil, fmt.Errorf( "%s: bad span: %#v", pre, ss)
+        }
+    }
+    return state, nil
+}
+
+// Reads a State, as written by SaveState, and merges its stats into the
+// learners: weights and cumuls are summed, mins and maxes kept, histograms
+// and variances combined. So into a fresh process it is a restore. Spans not
+// yet known are tracked, after the known ones, in the State's order. Its
+// Since_init is added to this process's, for Time_frac and later SaveStates.
+// Must be called after Init.
+func LoadState( r io.Reader) (err error) {
+    state, err := ReadState( r)
+    if (err != nil) { return err}
+
+    if (!init_completed || Serve_finished) { return fmt.Errorf( "latlearn.LoadState: not running")}
+
+    done_chan := make( chan bool, 1)
+    comm_outer <- comm_msg{ ttype: "load-state", state:state, done:done_chan}
+    <- done_chan
+    return nil
+}
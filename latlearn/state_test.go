@@ -0,0 +1,22 @@
+package latlearn_test
+
+import (
+    "strings"
+    "testing"
+
+    "."
+)
+
+func TestLoadStateBad( t *testing.T) {
+    for _, txt := range []string {
+        ``,
+        `{"format": "latlearn-report", "version": 1}`,
+        `{"format": "latlearn-state", "version": 99}`,
+        `{"format": "latlearn-state", "version": 1, "spans": [{"name": ""}]}`,
+        `{"format": "latlearn-state", "version": 1, "spans": [{"name": "x", "weight": -1}]}`} {
+
+        if err := latlearn.LoadState( strings.NewReader( txt)); (err == nil) || strings.Contains( err.Error(), "not running") {
+            t.Errorf( "LoadState '%s': want a format error, got %v", txt, err)
+        }
+    }
+}
@@ -0,0 +1,165 @@
+// timeseries.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "strings"
+    "time"
+)
+
+// The learners' lifetime aggregates hide trends, like a slow warm-up or a
+// creeping degradation. So, optionally, each learner also keeps a ring of
+// per-interval buckets (count, sum, min, max) for the last
+// Timeseries_intervals intervals, each Timeseries_interval long. Samples are
+// bucketed by when they ended. The series is in the JSON report, from the
+// Series snapshot call, and drawn as a sparkline column in the text report.
+//
+// NOTE: These settings ONLY take effect if set BEFORE Init is called
+var Timeseries_interval  time.Duration = 0   // like time.Second. 0 keeps no series
+var Timeseries_intervals int           = 600 // how many intervals the ring keeps
+
+// The text report's sparkline width, in chars. Each is the mean of one or
+// more intervals. Read as each report is written, so may be changed any time.
+var Sparkline_width      int           = 30
+
+// One interval of a span's time series. Start is since Init. Latencies are
+// in ns, and not overhead compensated. If Count is 0, Min and Max are too.
+type SeriesBucket struct {
+    Start time.Duration `json:"start_ns"`
+    Count int64         `json:"count"`
+    Sum   int64         `json:"sum"`
+    Min   int64         `json:"min"`
+    Max   int64         `json:"max"`
+}
+
+// for latlearn's internal use only
+type timeSeries struct {
+    interval time.Duration
+    ring     []SeriesBucket
+    idxs     []int64 // the interval number in each ring slot. -1 if never used
+    latest   int64   // the greatest interval number seen
+}
+
+// for latlearn's internal use only
+//
+// Adds a sample which ended at end (since Init) to ll's series, if series are
+// kept. Samples from before the ring's window are dropped.
+func (ll *latencyLearner) series_add( end time.Duration, dur time.Duration) {
+    if (Timeseries_interval <= 0) || (Timeseries_intervals < 1) { return}
+
+    ts          := ll.ts
+    if (ts      == nil) {
+        ts       = &timeSeries{
+                       interval: Timeseries_interval,
+                       ring:     make( []SeriesBucket, Timeseries_intervals),
+                       idxs:     make( []int64, Timeseries_intervals)}
+        for i   := range ts.idxs {
+            ts.idxs[ i] = -1
+        }
+        ll.ts    = ts
+    }
+
+    n           := int64( len( ts.ring))
+    idx         := int64( end / ts.interval)
+    if (idx      < 0) { idx = 0}
+    if (idx     <= ts.latest - n) { return} // too old
+    if (idx      > ts.latest) { ts.latest = idx}
+
+    slot        := idx % n
+    if (ts.idxs[ slot] != idx) {
+        ts.idxs[ slot] = idx
+        ts.ring[ slot] = SeriesBucket{ Start: time.Duration( idx) * ts.interval}
+    }
+    b           := &ts.ring[ slot]
+    d           := int64( dur)
+    if (b.Count == 0) || (d < b.Min) { b.Min = d}
+    if (b.Count == 0) || (d > b.Max) { b.Max = d}
+    b.Count++
+    b.Sum       += d
+}
+
+// for latlearn's internal use only
+//
+// The series for the intervals up to the one holding now (since Init),
+// oldest first, with empty intervals as zero buckets, so evenly spaced.
+func (ll *latencyLearner) series( now time.Duration) (sbs []SeriesBucket) {
+    ts          := ll.ts
+    if (ts      == nil) { return nil}
+
+    n           := int64( len( ts.ring))
+    last        := int64( now / ts.interval)
+    if (ts.latest > last) { last = ts.latest}
+    first       := last - n + 1
+    if (first    < 0) { first = 0}
+
+    for idx     := first; idx <= last; idx++ {
+        slot    := idx % n
+        if (ts.idxs[ slot] == idx) {
+            sbs  = append( sbs, ts.ring[ slot])
+        } else {
+            sbs  = append( sbs, SeriesBucket{ Start: time.Duration( idx) * ts.interval})
+        }
+    }
+    return sbs
+}
+
+// for latlearn's internal use only
+//
+// Draws the mean latency over time, as width block chars, each the mean of
+// an equal share of the buckets (the newest at the right.) Scaled from the
+// least to the greatest of those means. A share with no samples is a space.
+func sparkline( sbs []SeriesBucket, width int) string {
+    if (len( sbs) == 0) || (width < 1) { return ""}
+    if (width > len( sbs)) { width = len( sbs)}
+
+    blocks      := []rune( "▁▂▃▄▅▆▇█")
+    means       := make( []float64, width)
+    filled      := make( []bool, width)
+    lo, hi      := 0.0, 0.0
+    seen        := false
+    for i       := 0; i < width; i++ {
+        count, sum := int64( 0), int64( 0)
+        for _, b   := range sbs[ (i * len( sbs)) / width : ((i + 1) * len( sbs)) / width] {
+            count  += b.Count
+            sum    += b.Sum
+        }
+        if (count == 0) { continue}
+        means[ i]   = float64( sum) / float64( count)
+        if !seen || (means[ i] < lo) { lo = means[ i]}
+        if !seen || (means[ i] > hi) { hi = means[ i]}
+        filled[ i], seen = true, true
+    }
+
+    var sb strings.Builder
+    for i       := 0; i < width; i++ {
+        if !filled[ i] { sb.WriteRune( ' '); continue}
+        level   := 0
+        if (hi   > lo) { level = int( (means[ i] - lo) / (hi - lo) * float64( len( blocks) - 1) + 0.5)}
+        sb.WriteRune( blocks[ level])
+    }
+    return sb.String()
+}
+
+// for internal, latlearn-only, use
+func handle_msg_series( msg comm_msg) {
+    if (msg.reply_chan == nil) { return}
+
+    key        := span_key_form( msg.name, msg.variant)
+    reply      := ReplyMsg{ ttype: msg.ttype, Name: key}
+    if lli, found := learners[ key]; found && (lli != nil) {
+        reply.Series = lli.getLL().series( time.Since( init_time))
+    }
+    msg.reply_chan <- reply
+}
+
+// Returns a snapshot of the span's time series (see Timeseries_interval),
+// oldest interval first. Empty if series are not kept, or the span is unknown.
+func Series( span string) (series []SeriesBucket, ok bool) {
+    if (!init_completed || Serve_finished) { return nil, false}
+
+    reply_chan := make( chan ReplyMsg, 1)
+    comm_outer <- comm_msg{ ttype: "series", name: span, reply_chan: reply_chan}
+    reply      := <-reply_chan
+    return reply.Series, true
+}
@@ -0,0 +1,229 @@
+// top.go, part of LatLearn
+//     project: https://github.com/mkramlich/LatLearn
+
+package latlearn
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+)
+
+// How Top draws. The zero value is usable: it redraws every second, sorted by
+// mean, all rows, flagging a 1.5x deviation.
+type TopOpts struct {
+    Interval  time.Duration // between redraws. 0 means 1s
+    Sort      string        // "mean", "max", "tf" (time frac), "weight", "rate" or "name". "" means "mean"
+    Rows      int           // at most this many span rows. 0 means all
+    Deviation float64       // flag a span whose recent mean is this many times above (or below) its baseline. 0 means 1.5
+    Builtins  bool          // also show the "LL." spans
+    No_color  bool          // no ANSI colors, like when w is not a tty. the screen is still cleared
+}
+
+// The keys TopOpts.Sort accepts.
+var Top_sort_keys = []string { "mean", "max", "tf", "weight", "rate", "name"}
+
+// for latlearn's internal use only
+const (
+    ansi_home_clear = "\x1b[H\x1b[2J"
+    ansi_red        = "\x1b[31m"
+    ansi_green      = "\x1b[32m"
+    ansi_bold       = "\x1b[1m"
+    ansi_reset      = "\x1b[0m"
+)
+
+// for latlearn's internal use only
+type top_row struct {
+    sd     SpanData
+    rate   float64 // samples per second, over the last interval. -1 if unknown
+    recent int64   // mean over the last interval, in ns. -1 if none
+    flag   int     // +1 if recent is above the baseline by the deviation, -1 if below, else 0
+}
+
+// Draws a live, top-style view of this process's spans on w (usually
+// os.Stdout, a tty), redrawn in place every opts.Interval until ctx is done.
+// Blocks, so is usually run in its own goroutine. See TopFrom.
+func Top( ctx context.Context, w io.Writer, opts TopOpts) (err error) {
+    return TopFrom( ctx, w, opts, func() (*ReportData, error) {
+        rd, ok := Snapshot()
+        if !ok { return nil, fmt.Errorf( "latlearn not running")}
+        return rd, nil
+    })
+}
+
+// Like Top, but the stats come from calling snap, like to watch another
+// process (see cmd/latlearn-top.) Rates and recent means are of the change
+// between two snaps, so the first frame has neither. An error from snap is
+// shown in the frame, and the next snap is tried. Returns nil once ctx is
+// done, or the first error writing to w, or at once if opts.Sort is unknown.
+func TopFrom( ctx context.Context, w io.Writer, opts TopOpts, snap func() (*ReportData, error)) (err error) {
+    known      := (opts.Sort == "")
+    for _, key := range Top_sort_keys {
+        if (opts.Sort == key) { known = true}
+    }
+    if !known { return fmt.Errorf( "latlearn.TopFrom: unknown sort key '%s'. want one of %v", opts.Sort, Top_sort_keys)}
+
+    interval   := opts.Interval
+    if (interval <= 0) { interval = time.Second}
+
+    ticker     := time.NewTicker( interval)
+    defer ticker.Stop()
+
+    var prev *ReportData
+    for {
+        cur, snap_err := snap()
+        if (snap_err != nil) {
+            _, err = io.WriteString( w, ansi_home_clear + fmt.Sprintf( "latlearn top: %v\n", snap_err))
+        } else {
+            err    = WriteTopFrame( w, prev, cur, opts)
+            prev   = cur
+        }
+        if (err != nil)       { return err}
+        if (ctx.Err() != nil) { return nil} // a select picks at random when both are ready
+
+        select {
+            case <-ctx.Done(): return nil
+            case <-ticker.C:
+        }
+    }
+}
+
+// for latlearn's internal use only
+//
+// A span's Weight and Cumul, as 0 if it never completed (where they are -1.)
+func top_weight( sd SpanData) int   { if !sd.Completed { return 0}; return sd.Weight}
+func top_cumul(  sd SpanData) int64 { if !sd.Completed { return 0}; return sd.Cumul}
+
+// for latlearn's internal use only
+//
+// A span's mean before any overhead was taken off (see
+// Should_subtract_overhead), and how much was. 0 if it has no samples.
+func top_raw_mean( sd SpanData) (raw int64, overhead int64) {
+    if (top_weight( sd) <= 0) { return 0, 0}
+    raw         = sd.Cumul / int64( sd.Weight)
+    if (sd.Mean >= 0) && (sd.Mean < raw) { overhead = raw - sd.Mean}
+    return raw, overhead
+}
+
+// Writes one frame of Top: cur's spans, with the rates and recent means of
+// the change since prev (which may be nil.) A span's baseline is its mean as
+// of prev, before any overhead was taken off, as the recent mean is compared
+// to it before its overhead is. Starts by clearing the screen.
+func WriteTopFrame( w io.Writer, prev *ReportData, cur *ReportData, opts TopOpts) (err error) {
+    deviation  := opts.Deviation
+    if (deviation <= 1) { deviation = 1.5}
+    sort_key   := opts.Sort
+    if (sort_key == "") { sort_key = "mean"}
+
+    elapsed    := time.Duration( 0)
+    before     := map[string]SpanData {}
+    if (prev   != nil) {
+        elapsed = time.Duration( cur.Since_init - prev.Since_init)
+        for _, sd := range prev.Spans {
+            before[ sd.Name] = sd
+        }
+    }
+
+    rows       := []top_row {}
+    for _, sd  := range cur.Spans {
+        if !opts.Builtins && strings.HasPrefix( sd.Name, "LL.") { continue}
+
+        row    := top_row{ sd: sd, rate: -1, recent: -1}
+        if b, found := before[ sd.Name]; found && (elapsed > 0) {
+            dw       := top_weight( sd) - top_weight( b)
+            row.rate  = float64( dw) / elapsed.Seconds()
+            if (dw > 0) {
+                // compared raw, as Cumuls are, then shown less the overhead, as Means are
+                recent      := (top_cumul( sd) - top_cumul( b)) / int64( dw)
+                _, overhead := top_raw_mean( sd)
+                row.recent   = recent - overhead
+                if (row.recent < 0) { row.recent = 0}
+                if base, _  := top_raw_mean( b); (base > 0) {
+                    switch {
+                        case (float64( recent) > float64( base) * deviation): row.flag = +1
+                        case (float64( recent) < float64( base) / deviation): row.flag = -1
+                    }
+                }
+            }
+        }
+        rows    = append( rows, row)
+    }
+
+    sort.SliceStable( rows, func( i, j int) bool {
+        a, b   := rows[ i], rows[ j]
+        switch sort_key {
+            case "max":    return a.sd.Max       > b.sd.Max
+            case "tf":     return a.sd.Time_frac > b.sd.Time_frac
+            case "weight": return a.sd.Weight    > b.sd.Weight
+            case "rate":   return a.rate         > b.rate
+            case "name":   return a.sd.Name      < b.sd.Name
+            default:       return a.sd.Mean      > b.sd.Mean
+        }
+    })
+    shown      := len( rows)
+    if (opts.Rows > 0) && (shown > opts.Rows) { shown = opts.Rows}
+
+    color      := func( code string, s string) string {
+        if opts.No_color { return s}
+        return code + s + ansi_reset
+    }
+
+    longest    := len( "span")
+    for _, row := range rows[ :shown] {
+        if (len( row.sd.Name) > longest) { longest = len( row.sd.Name)}
+    }
+    format     := fmt.Sprintf( "%%-%ds  %%15s  %%15s  %%13s  %%10s  %%9s  %%15s  %%s", longest)
+
+    ew         := &err_writer{ w: w}
+    io.WriteString( ew, ansi_home_clear)
+    fmt.Fprintf(    ew, "latlearn top - since init %s - sort %s - %d of %d spans - %s flags a recent mean %.2gx off its baseline\n\n",
+        time.Duration( cur.Since_init).Round( time.Millisecond), sort_key, shown, len( rows),
+        color( ansi_red, "▲") + "/" + color( ansi_green, "▼"), deviation)
+    fmt.Fprintln(   ew, color( ansi_bold, fmt.Sprintf( format,
+        "span", "mean (ns)", "max (ns)", "weight (B&As)", "rate (/s)", "time frac", "recent (ns)", "")))
+
+    for _, row := range rows[ :shown] {
+        rate   := "-"
+        if (row.rate >= 0) { rate = fmt.Sprintf( "%.1f", row.rate)}
+        recent := "-"
+        if (row.recent >= 0) { recent = number_grouped( row.recent, ",")}
+        mark   := ""
+        switch row.flag {
+            case +1: mark = color( ansi_red,   "▲")
+            case -1: mark = color( ansi_green, "▼")
+        }
+        line   := fmt.Sprintf( format,
+                      row.sd.Name, number_grouped( row.sd.Mean, ","), number_grouped( row.sd.Max, ","),
+                      number_grouped( int64( row.sd.Weight), ","), rate,
+                      fmt.Sprintf( "%.6f", row.sd.Time_frac), recent, mark)
+        fmt.Fprintln( ew, strings.TrimRight( line, " "))
+    }
+    return ew.err
+}
+
+// An http.Handler which serves a Snapshot as a JSON report (the same as
+// Report_json_fpath gets), so that cmd/latlearn-top, or anything else which
+// can ReadReport, can watch this process over a local endpoint. Like:
+//
+//     go http.ListenAndServe( "localhost:6061", latlearn.SnapshotHandler())
+func SnapshotHandler() http.Handler {
+    return http.HandlerFunc( func( w http.ResponseWriter, r *http.Request) {
+        rd, ok := Snapshot()
+        if !ok {
+            http.Error( w, "latlearn not running", http.StatusServiceUnavailable)
+            return
+        }
+        data, err := json.MarshalIndent( rd, "", "  ")
+        if (err != nil) {
+            http.Error( w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        w.Header().Set( "Content-Type", "application/json")
+        w.Write( append( data, '\n'))
+    })
+}
@@ -0,0 +1,102 @@
+package latlearn_test
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "strings"
+    "testing"
+
+    "."
+)
+
+func TestWriteTopFrame( t *testing.T) {
+    prev  := &latlearn.ReportData{ Since_init: 1e9, Spans: []latlearn.SpanData {
+                 span_row( "slower", 100, 10),
+                 span_row( "faster", 100, 10),
+                 span_row( "steady", 100, 10),
+                 span_row( "LL.no-op", 5, 10)}}
+    slower := span_row( "slower", 0, 0)
+    slower.Weight, slower.Cumul = 20, 1000 + 10 * 300 // recent mean 300
+    slower.Mean   = slower.Cumul / 20
+    faster := span_row( "faster", 0, 0)
+    faster.Weight, faster.Cumul = 30, 1000 + 20 * 10  // recent mean 10
+    faster.Mean   = faster.Cumul / 30
+    cur   := &latlearn.ReportData{ Since_init: 3e9, Spans: []latlearn.SpanData {
+                 slower, faster, span_row( "steady", 100, 14), span_row( "new", 50, 1), span_row( "LL.no-op", 5, 20)}}
+
+    var buf bytes.Buffer
+    if err := latlearn.WriteTopFrame( &buf, prev, cur, latlearn.TopOpts{ Sort: "rate", No_color: true}); (err != nil) {
+        t.Fatalf( "WriteTopFrame: %v", err)
+    }
+    lines := strings.Split( strings.TrimRight( buf.String(), "\n"), "\n")
+    if !strings.HasPrefix( lines[ 0], "\x1b[H\x1b[2J") || strings.Contains( buf.String(), "\x1b[3") || strings.Contains( buf.String(), "LL.no-op") {
+        t.Errorf( "WriteTopFrame: want a cleared screen, no colors and no builtins, got:\n%s", buf.String())
+    }
+    rows  := lines[ 3:]
+    want  := []struct{ name, rate, mark string } {
+                 { "faster", "10.0", "▼"}, { "slower", "5.0", "▲"}, { "steady", "2.0", ""}, { "new", "-", ""}}
+    if (len( rows) != len( want)) {
+        t.Fatalf( "WriteTopFrame: want %d rows, got:\n%s", len( want), buf.String())
+    }
+    for i, w := range want {
+        fields := strings.Fields( rows[ i])
+        last   := fields[ len( fields) - 1]
+        if (fields[ 0] != w.name) || !strings.Contains( rows[ i], " " + w.rate + " ") || ((w.mark != "") != (last == w.mark)) {
+            t.Errorf( "WriteTopFrame row %d: want %s at %s/s marked '%s', got '%s'", i, w.name, w.rate, w.mark, rows[ i])
+        }
+    }
+
+    buf.Reset()
+    latlearn.WriteTopFrame( &buf, nil, cur, latlearn.TopOpts{ Sort: "name", Rows: 2, Builtins: true})
+    lines  = strings.Split( strings.TrimRight( buf.String(), "\n"), "\n")
+    if (len( lines) != 5) || !strings.HasPrefix( lines[ 3], "LL.no-op") || strings.Contains( buf.String(), "▲ ") {
+        t.Errorf( "WriteTopFrame of a first frame, by name, 2 rows: got:\n%s", buf.String())
+    }
+
+    // a span which had not yet completed by prev has its first samples' rate & mean
+    unsampled := latlearn.SpanData{ Name: "first", Min: -1, Last: -1, Max: -1, Mean: -1, Cumul: -1, Weight: -1}
+    buf.Reset()
+    latlearn.WriteTopFrame( &buf,
+        &latlearn.ReportData{ Since_init: 1e9, Spans: []latlearn.SpanData { unsampled}},
+        &latlearn.ReportData{ Since_init: 3e9, Spans: []latlearn.SpanData { span_row( "first", 100, 4)}},
+        latlearn.TopOpts{ No_color: true})
+    lines  = strings.Split( strings.TrimRight( buf.String(), "\n"), "\n")
+    if fields := strings.Fields( lines[ len( lines) - 1]); (fields[ 0] != "first") || (fields[ 4] != "2.0") || (fields[ 6] != "100") {
+        t.Errorf( "WriteTopFrame of a span first completed since prev: want 2.0/s, recent 100, got '%s'", lines[ len( lines) - 1])
+    }
+
+    // with Should_subtract_overhead, Means are less the overhead, but Cumuls are not
+    comp_prev := span_row( "steady", 40, 10)
+    comp_prev.Cumul = 100 * 10
+    comp_cur  := span_row( "steady", 40, 20)
+    comp_cur.Cumul  = 100 * 20
+    buf.Reset()
+    latlearn.WriteTopFrame( &buf,
+        &latlearn.ReportData{ Since_init: 1e9, Should_subtract_overhead: true, Spans: []latlearn.SpanData { comp_prev}},
+        &latlearn.ReportData{ Since_init: 2e9, Should_subtract_overhead: true, Spans: []latlearn.SpanData { comp_cur}},
+        latlearn.TopOpts{ No_color: true})
+    lines  = strings.Split( strings.TrimRight( buf.String(), "\n"), "\n")
+    if fields := strings.Fields( lines[ len( lines) - 1]); (len( fields) != 7) || (fields[ 6] != "40") {
+        t.Errorf( "WriteTopFrame with Should_subtract_overhead: want a steady span's recent 40, like its mean, & no flag, got '%s'", lines[ len( lines) - 1])
+    }
+}
+
+func TestTopFrom( t *testing.T) {
+    if err := latlearn.TopFrom( context.Background(), &bytes.Buffer{}, latlearn.TopOpts{ Sort: "nosuch"}, nil); (err == nil) {
+        t.Errorf( "TopFrom with an unknown sort key: want an error")
+    }
+
+    ctx, cancel := context.WithCancel( context.Background())
+    snaps := 0
+    var buf bytes.Buffer
+    err   := latlearn.TopFrom( ctx, &buf, latlearn.TopOpts{ Interval: 1}, func() (*latlearn.ReportData, error) {
+                 snaps++
+                 if (snaps == 3) { cancel()}
+                 if (snaps == 2) { return nil, errors.New( "no report yet")}
+                 return &latlearn.ReportData{ Since_init: int64( snaps), Spans: []latlearn.SpanData { span_row( "fn", 100, snaps)}}, nil
+             })
+    if (err != nil) || (snaps != 3) || !strings.Contains( buf.String(), "latlearn top: no report yet") {
+        t.Errorf( "TopFrom: want 3 snaps, the error shown, and nil once cancelled. got %v, %d snaps:\n%s", err, snaps, buf.String())
+    }
+}